@@ -0,0 +1,258 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// frakti-bench creates and destroys sandboxes and containers against a live
+// frakti, and reports latency percentiles of each operation, for capacity
+// planning and detecting performance regressions.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+var (
+	endpoint = flag.String("endpoint", "/var/run/frakti.sock",
+		"The unix socket of frakti")
+	sandboxes = flag.Int("sandboxes", 10,
+		"The number of sandboxes to create")
+	containers = flag.Int("containers", 1,
+		"The number of containers to create in each sandbox")
+	parallelism = flag.Int("parallelism", 1,
+		"The number of sandboxes created concurrently")
+	image = flag.String("image", "busybox",
+		"The image of containers")
+	timeout = flag.Duration("timeout", 5*time.Minute,
+		"The timeout of each operation")
+)
+
+// Benchmarked operations, in the order they are reported.
+var operations = []string{
+	"create_sandbox",
+	"create_container",
+	"start_container",
+	"stop_sandbox",
+	"delete_sandbox",
+}
+
+// results collects the latencies and errors of each operation.
+type results struct {
+	sync.Mutex
+	latencies map[string][]time.Duration
+	errors    map[string]int
+}
+
+func newResults() *results {
+	return &results{
+		latencies: make(map[string][]time.Duration),
+		errors:    make(map[string]int),
+	}
+}
+
+// record records the latency of an operation started at start if err is nil,
+// otherwise counts the error. It returns err.
+func (r *results) record(operation string, start time.Time, err error) error {
+	r.Lock()
+	defer r.Unlock()
+
+	if err != nil {
+		r.errors[operation]++
+		return err
+	}
+	r.latencies[operation] = append(r.latencies[operation], time.Since(start))
+	return nil
+}
+
+// percentile returns the p-th percentile of sorted latencies.
+func percentile(latencies []time.Duration, p int) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+	i := (len(latencies)*p+99)/100 - 1
+	if i < 0 {
+		i = 0
+	}
+	return latencies[i]
+}
+
+func (r *results) report() {
+	r.Lock()
+	defer r.Unlock()
+
+	fmt.Printf("%-18s %6s %6s %12s %12s %12s %12s\n", "OPERATION", "OK", "ERRORS", "P50", "P90", "P99", "MAX")
+	for _, operation := range operations {
+		latencies := r.latencies[operation]
+		sort.Sort(durations(latencies))
+		fmt.Printf("%-18s %6d %6d %12v %12v %12v %12v\n", operation, len(latencies), r.errors[operation],
+			percentile(latencies, 50), percentile(latencies, 90), percentile(latencies, 99), percentile(latencies, 100))
+	}
+}
+
+type durations []time.Duration
+
+func (d durations) Len() int           { return len(d) }
+func (d durations) Less(i, j int) bool { return d[i] < d[j] }
+func (d durations) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+
+type bench struct {
+	client  kubeapi.RuntimeServiceClient
+	results *results
+	runID   string
+}
+
+func (b *bench) call(operation string, f func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	start := time.Now()
+	return b.results.record(operation, start, f(ctx))
+}
+
+// runSandbox creates a sandbox with its containers, then destroys it.
+func (b *bench) runSandbox(index int) {
+	name := fmt.Sprintf("frakti-bench-%s-%d", b.runID, index)
+	config := &kubeapi.PodSandboxConfig{
+		Name:     &name,
+		Hostname: &name,
+	}
+
+	var podID string
+	err := b.call("create_sandbox", func(ctx context.Context) error {
+		resp, err := b.client.CreatePodSandbox(ctx, &kubeapi.CreatePodSandboxRequest{Config: config})
+		if err == nil {
+			podID = resp.GetPodSandboxId()
+		}
+		return err
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Create sandbox %s failed: %v\n", name, err)
+		return
+	}
+
+	for i := 0; i < *containers; i++ {
+		containerName := fmt.Sprintf("container-%d", i)
+		var containerID string
+		err := b.call("create_container", func(ctx context.Context) error {
+			resp, err := b.client.CreateContainer(ctx, &kubeapi.CreateContainerRequest{
+				PodSandboxId: &podID,
+				Config: &kubeapi.ContainerConfig{
+					Name:  &containerName,
+					Image: &kubeapi.ImageSpec{Image: image},
+				},
+				SandboxConfig: config,
+			})
+			if err == nil {
+				containerID = resp.GetContainerId()
+			}
+			return err
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Create container %s in sandbox %s failed: %v\n", containerName, name, err)
+			continue
+		}
+
+		err = b.call("start_container", func(ctx context.Context) error {
+			_, err := b.client.StartContainer(ctx, &kubeapi.StartContainerRequest{ContainerId: &containerID})
+			return err
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Start container %s in sandbox %s failed: %v\n", containerName, name, err)
+		}
+	}
+
+	err = b.call("stop_sandbox", func(ctx context.Context) error {
+		_, err := b.client.StopPodSandbox(ctx, &kubeapi.StopPodSandboxRequest{PodSandboxId: &podID})
+		return err
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Stop sandbox %s failed: %v\n", name, err)
+	}
+
+	err = b.call("delete_sandbox", func(ctx context.Context) error {
+		_, err := b.client.DeletePodSandbox(ctx, &kubeapi.DeletePodSandboxRequest{PodSandboxId: &podID})
+		return err
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Delete sandbox %s failed: %v\n", name, err)
+	}
+}
+
+func main() {
+	flag.Parse()
+
+	if *sandboxes <= 0 || *containers < 0 || *parallelism <= 0 {
+		fmt.Println("sandboxes and parallelism must be positive, containers must not be negative")
+		os.Exit(1)
+	}
+
+	conn, err := grpc.Dial(*endpoint, grpc.WithInsecure(), grpc.WithTimeout(*timeout),
+		grpc.WithDialer(func(addr string, timeout time.Duration) (net.Conn, error) {
+			return net.DialTimeout("unix", addr, timeout)
+		}))
+	if err != nil {
+		fmt.Println("Connect to frakti failed: ", err)
+		os.Exit(1)
+	}
+	defer conn.Close()
+
+	b := &bench{
+		client:  kubeapi.NewRuntimeServiceClient(conn),
+		results: newResults(),
+		runID:   fmt.Sprintf("%d", time.Now().Unix()),
+	}
+
+	if *containers > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		_, err := kubeapi.NewImageServiceClient(conn).PullImage(ctx, &kubeapi.PullImageRequest{
+			Image: &kubeapi.ImageSpec{Image: image},
+		})
+		cancel()
+		if err != nil {
+			fmt.Println("Pull image failed: ", err)
+			os.Exit(1)
+		}
+	}
+
+	start := time.Now()
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < *parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				b.runSandbox(index)
+			}
+		}()
+	}
+	for i := 0; i < *sandboxes; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	fmt.Printf("Ran %d sandboxes with %d containers each in %v\n", *sandboxes, *containers, time.Since(start))
+	b.results.report()
+}
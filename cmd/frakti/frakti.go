@@ -19,10 +19,15 @@ package main
 import (
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 
+	"k8s.io/frakti/pkg/features"
 	"k8s.io/frakti/pkg/hyper"
 	"k8s.io/frakti/pkg/manager"
+	"k8s.io/frakti/pkg/runtime/fake"
 )
 
 const (
@@ -35,6 +40,101 @@ var (
 		"The sockets to listen on, e.g. /var/run/frakti.sock")
 	hyperEndpoint = flag.String("hyper-endpoint", "127.0.0.1:22318",
 		"The endpoint for connecting hyperd, e.g. 127.0.0.1:22318")
+	fakeRuntimeFaultsConfig = flag.String("fake-runtime-faults-config", "",
+		"If set, serve an in-memory fake runtime instead of hyperd, with faults injected as configured in this JSON file, for soak tests")
+	nodeLabelsFile = flag.String("node-labels-file", "",
+		"The file to write node labels describing the capabilities of this node, in kubelet's flag format")
+	reservedFile = flag.String("reserved-file", "",
+		"If set, write recommended kubelet kube-reserved/system-reserved flags to this file")
+	maxPods    = flag.Int("max-pods", 110, "The maximum number of pods kubelet runs on this node")
+	vmPoolSize = flag.Int("vm-pool-size", 0, "The number of pre-created VMs kept by hyperd")
+
+	sandboxBootTimeout = flag.Duration("sandbox-boot-timeout", 2*time.Minute,
+		"The timeout for booting a sandbox VM")
+	agentHandshakeTimeout = flag.Duration("agent-handshake-timeout", 30*time.Second,
+		"The timeout for the guest agent of a sandbox VM becoming ready")
+	runtimeHandlersConfig = flag.String("runtime-handlers-config", "",
+		"The JSON file of runtime handlers (RuntimeClass) mapping handler names to sandbox configurations")
+	qosProfilesConfig = flag.String("qos-profiles-config", "",
+		"The JSON file mapping pod QoS classes to the runtime handlers of sandboxes not selecting one")
+	namespacePolicyConfig = flag.String("namespace-policy-config", "",
+		"The JSON file mapping kubernetes namespaces to their sandbox and container policies")
+	networkHooksDir = flag.String("network-hooks-dir", "",
+		"The directory of executables run with add/remove/resync when sandbox networks are added, removed or should be re-validated")
+	networkTeardownsFile = flag.String("network-teardowns-file", "",
+		"The file persisting failed network teardowns, so that they are retried after restarts")
+	blockMetadataAccess = flag.Bool("block-metadata-access", false,
+		"Block sandboxes from reaching the link-local metadata endpoint unless allowed by annotation")
+	cadvisorListen = flag.String("cadvisor-listen", "",
+		"The address serving collected sandbox stats by cadvisor-compatible API, empty means disabled")
+	coreDumpDir = flag.String("core-dump-dir", "",
+		"The directory core dumps of containers are routed to, in a sub-directory per sandbox, empty means disabled")
+	coreDumpQuota = flag.Int64("core-dump-quota", 1024*1024*1024,
+		"The max bytes of core dumps kept per sandbox, the oldest ones are removed when exceeded")
+	maxEnvSize = flag.Int("max-env-size", 1024*1024,
+		"The max total size in bytes of environment variables of a container, 0 means unlimited")
+	offlineMode = flag.Bool("offline-mode", false,
+		"Use local images when pulling them fails, and pull them again in background")
+	maxSandboxes = flag.Int("max-sandboxes", 0,
+		"The max number of sandboxes on this node, 0 means unlimited")
+	maxTotalVMMemory = flag.Int64("max-total-vm-memory-mb", 0,
+		"The max total memory in MB of sandbox VMs on this node, 0 means unlimited")
+	allowEmulation = flag.Bool("allow-emulation", false,
+		"Allow creating sandboxes without KVM by software emulation, which is much slower")
+	resourcePreflight = flag.Bool("resource-preflight", false,
+		"Check the node has enough free cpu, memory and disk before booting sandbox VMs")
+	preflightMargin = flag.Int64("preflight-margin-mb", 256,
+		"The memory and disk in MB kept free on top of sandbox VMs by the resource preflight")
+	insecureRegistries = flag.String("insecure-registries", "",
+		"Comma separated registries served by plain HTTP, as configured in hyperd")
+	mirroredRegistries = flag.String("mirrored-registries", "",
+		"Comma separated registries pulled through mirrors configured in hyperd, e.g. registry-1.docker.io")
+	removalQueueFile = flag.String("removal-queue-file", "",
+		"The file persisting sandboxes pending removal, if set sandboxes are removed asynchronously")
+	statsInterval = flag.Duration("stats-interval", 10*time.Second,
+		"The interval of collecting sandbox statistics into metrics, 0 means disabled")
+	logRateLimit = flag.Int64("log-rate-limit", 10*1024*1024,
+		"The max bytes per second copied from a container's output to its log file, 0 means unlimited")
+	logMaxSize = flag.Int64("log-max-size", 0,
+		"The size in bytes a container log file is rotated at, 0 means never rotate")
+	logMaxFiles = flag.Int("log-max-files", 5,
+		"The max number of log files kept for a container, including the current one")
+	logDrivers = flag.String("log-drivers", "file",
+		"Comma separated log drivers of containers, valid values are file, journald and fluentd")
+	fluentdAddress = flag.String("fluentd-address", "127.0.0.1:24224",
+		"The address of fluentd's forward input, a unix socket path or a tcp address")
+
+	debugListen = flag.String("debug-listen", "",
+		"If set, serve the debug endpoint on this address, e.g. /var/run/frakti-debug.sock or 127.0.0.1:22520")
+	execMaxSessions = flag.Int("exec-max-sessions", 10,
+		"The max number of concurrent exec sessions per container, 0 means unlimited")
+	execIdleTimeout = flag.Duration("exec-idle-timeout", 4*time.Hour,
+		"Idle exec sessions are closed after this duration, 0 means never")
+	imagePrefetchDir = flag.String("image-prefetch-dir", "",
+		"If set, prefetch images listed (one per line) in files dropped into this directory. Write files under a dotfile or .tmp name and rename them into place")
+	imagePrefetchInterval = flag.Duration("image-prefetch-interval", 30*time.Second,
+		"The interval of scanning the image prefetch directory")
+	upgradeSocket = flag.String("upgrade-socket", "",
+		"If set, the unix socket through which the listening socket is handed off to a new frakti process on upgrade, requires the ListenerHandoff feature gate")
+
+	streamingBindAddress = flag.String("streaming-bind-address", "",
+		"If set, serve exec streams over mutual TLS on this IP address, e.g. 0.0.0.0, requires the --streaming-tls-* flags")
+	streamingAdvertiseAddress = flag.String("streaming-advertise-address", "",
+		"The IP address of the streaming server advertised to clients, defaults to --streaming-bind-address")
+	streamingPortRange = flag.String("streaming-port-range", "10010-10020",
+		"The range of ports the streaming server listens on, the first available one is used")
+	streamingTLSCertFile = flag.String("streaming-tls-cert-file", "",
+		"The TLS certificate file of the streaming server")
+	streamingTLSKeyFile = flag.String("streaming-tls-key-file", "",
+		"The TLS private key file of the streaming server")
+	streamingTLSClientCAFile = flag.String("streaming-tls-client-ca-file", "",
+		"The CA file verifying client certificates of the streaming server")
+	grpcMaxConcurrentStreams = flag.Uint("grpc-max-concurrent-streams", 0,
+		"The max number of concurrent streams of each gRPC connection, 0 means the gRPC default")
+	grpcMaxRecvMsgSize = flag.Int("grpc-max-recv-msg-size", 0,
+		"The max size in bytes of received gRPC messages, 0 means unlimited")
+	featureGates = flag.String("feature-gates", "",
+		"A comma separated list of name=bool enabling or disabling experimental features, e.g. ListenerHandoff=true")
 )
 
 func main() {
@@ -45,13 +145,157 @@ func main() {
 		os.Exit(0)
 	}
 
-	hyperRuntime, err := hyper.NewHyperRuntime(*hyperEndpoint)
+	if err := features.DefaultFeatureGate.Set(*featureGates); err != nil {
+		fmt.Println("Parse feature gates failed: ", err)
+		os.Exit(1)
+	}
+
+	if *fakeRuntimeFaultsConfig != "" {
+		serveFakeRuntime(*fakeRuntimeFaultsConfig)
+		return
+	}
+
+	hyperConfig := hyper.NewDefaultConfig()
+	hyperConfig.SandboxBootTimeout = *sandboxBootTimeout
+	hyperConfig.AgentHandshakeTimeout = *agentHandshakeTimeout
+	hyperConfig.LogRateLimit = *logRateLimit
+	hyperConfig.LogMaxSize = *logMaxSize
+	hyperConfig.LogMaxFiles = *logMaxFiles
+	hyperConfig.LogDrivers = strings.Split(*logDrivers, ",")
+	hyperConfig.FluentdAddress = *fluentdAddress
+	hyperConfig.NetworkHooksDir = *networkHooksDir
+	hyperConfig.NetworkTeardownsFile = *networkTeardownsFile
+	hyperConfig.BlockMetadataAccess = *blockMetadataAccess
+	hyperConfig.StatsInterval = *statsInterval
+	hyperConfig.CoreDumpDir = *coreDumpDir
+	hyperConfig.CoreDumpQuota = *coreDumpQuota
+	hyperConfig.MaxEnvSize = *maxEnvSize
+	hyperConfig.OfflineMode = *offlineMode
+	hyperConfig.MaxSandboxes = *maxSandboxes
+	hyperConfig.MaxTotalMemoryMB = *maxTotalVMMemory
+	hyperConfig.RemovalQueueFile = *removalQueueFile
+	hyperConfig.AllowEmulation = *allowEmulation
+	hyperConfig.ResourcePreflight = *resourcePreflight
+	hyperConfig.PreflightMarginMB = *preflightMargin
+	if *insecureRegistries != "" {
+		hyperConfig.InsecureRegistries = strings.Split(*insecureRegistries, ",")
+	}
+	if *mirroredRegistries != "" {
+		hyperConfig.MirroredRegistries = strings.Split(*mirroredRegistries, ",")
+	}
+
+	if *runtimeHandlersConfig != "" {
+		handlers, err := hyper.LoadRuntimeHandlers(*runtimeHandlersConfig)
+		if err != nil {
+			fmt.Println("Load runtime handlers failed: ", err)
+			os.Exit(1)
+		}
+		hyperConfig.RuntimeHandlers = handlers
+	}
+
+	if *qosProfilesConfig != "" {
+		profiles, err := hyper.LoadQoSProfiles(*qosProfilesConfig)
+		if err != nil {
+			fmt.Println("Load QoS profiles failed: ", err)
+			os.Exit(1)
+		}
+		hyperConfig.QoSProfiles = profiles
+	}
+
+	if *namespacePolicyConfig != "" {
+		policies, err := hyper.LoadNamespacePolicies(*namespacePolicyConfig)
+		if err != nil {
+			fmt.Println("Load namespace policies failed: ", err)
+			os.Exit(1)
+		}
+		hyperConfig.NamespacePolicies = policies
+	}
+
+	hyperRuntime, err := hyper.NewHyperRuntime(*hyperEndpoint, hyperConfig)
 	if err != nil {
 		fmt.Println("Initialize hyper runtime failed: ", err)
 		os.Exit(1)
 	}
 
-	server, err := manager.NewFraktiManager(hyperRuntime, hyperRuntime)
+	if *reservedFile != "" {
+		if err := hyper.WriteReservedResources(*reservedFile, *maxPods, *vmPoolSize); err != nil {
+			fmt.Println("Write reserved resources failed: ", err)
+			os.Exit(1)
+		}
+	}
+
+	if *nodeLabelsFile != "" {
+		if err := hyperRuntime.WriteNodeLabels(*nodeLabelsFile); err != nil {
+			fmt.Println("Write node labels failed: ", err)
+			os.Exit(1)
+		}
+	}
+
+	managerConfig := manager.NewDefaultConfig()
+	managerConfig.MaxSessionsPerContainer = *execMaxSessions
+	managerConfig.SessionIdleTimeout = *execIdleTimeout
+	managerConfig.ImagePrefetchDir = *imagePrefetchDir
+	managerConfig.ImagePrefetchInterval = *imagePrefetchInterval
+	managerConfig.UpgradeSocket = *upgradeSocket
+	managerConfig.MaxConcurrentStreams = uint32(*grpcMaxConcurrentStreams)
+	managerConfig.MaxRecvMsgSize = *grpcMaxRecvMsgSize
+
+	server, err := manager.NewFraktiManager(hyperRuntime, hyperRuntime, managerConfig)
+	if err != nil {
+		fmt.Println("Initialize frakti server failed: ", err)
+		os.Exit(1)
+	}
+
+	if *debugListen != "" {
+		go func() {
+			fmt.Println("Debug endpoint exited: ", server.ServeDebug(*debugListen))
+		}()
+	}
+
+	if *cadvisorListen != "" {
+		go func() {
+			fmt.Println("Cadvisor endpoint exited: ", http.ListenAndServe(*cadvisorListen, hyperRuntime.CadvisorHandler()))
+		}()
+	}
+
+	if *streamingBindAddress != "" {
+		streamingConfig := &manager.StreamingConfig{
+			BindAddress:      *streamingBindAddress,
+			AdvertiseAddress: *streamingAdvertiseAddress,
+			PortRange:        *streamingPortRange,
+			TLSCertFile:      *streamingTLSCertFile,
+			TLSKeyFile:       *streamingTLSKeyFile,
+			TLSClientCAFile:  *streamingTLSClientCAFile,
+		}
+		go func() {
+			fmt.Println("Streaming server exited: ", server.ServeStreaming(streamingConfig))
+		}()
+	}
+
+	fmt.Println(server.Serve(*listen))
+}
+
+// serveFakeRuntime serves the fake runtime and image services with faults
+// loaded from faultsConfig.
+func serveFakeRuntime(faultsConfig string) {
+	faults, err := fake.LoadFaults(faultsConfig)
+	if err != nil {
+		fmt.Println("Load fake runtime faults failed: ", err)
+		os.Exit(1)
+	}
+
+	runtimeService, err := fake.NewRuntimeService(faults)
+	if err != nil {
+		fmt.Println("Initialize fake runtime failed: ", err)
+		os.Exit(1)
+	}
+	imageService, err := fake.NewImageService(faults)
+	if err != nil {
+		fmt.Println("Initialize fake image service failed: ", err)
+		os.Exit(1)
+	}
+
+	server, err := manager.NewFraktiManager(runtimeService, imageService, manager.NewDefaultConfig())
 	if err != nil {
 		fmt.Println("Initialize frakti server failed: ", err)
 		os.Exit(1)
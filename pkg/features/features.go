@@ -0,0 +1,112 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package features
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Feature is the name of a feature gate.
+type Feature string
+
+const (
+	// SandboxCrashRecovery detects sandboxes whose VMs exited unexpectedly
+	// and stops them. Beta, enabled by default.
+	SandboxCrashRecovery Feature = "SandboxCrashRecovery"
+	// ListenerHandoff hands off the listening socket between frakti
+	// processes on upgrade through --upgrade-socket. Alpha, disabled by default.
+	ListenerHandoff Feature = "ListenerHandoff"
+)
+
+// defaultFeatures are the known features and their default states.
+var defaultFeatures = map[Feature]bool{
+	SandboxCrashRecovery: true,
+	ListenerHandoff:      false,
+}
+
+// FeatureGate tells whether features are enabled.
+type FeatureGate struct {
+	sync.RWMutex
+	enabled map[Feature]bool
+}
+
+// DefaultFeatureGate is the feature gate consulted by frakti.
+var DefaultFeatureGate = NewFeatureGate()
+
+// NewFeatureGate creates a FeatureGate with the default states of features.
+func NewFeatureGate() *FeatureGate {
+	enabled := make(map[Feature]bool, len(defaultFeatures))
+	for f, v := range defaultFeatures {
+		enabled[f] = v
+	}
+	return &FeatureGate{enabled: enabled}
+}
+
+// Set sets the feature states from a comma separated list of name=bool, e.g.
+// "SandboxCrashRecovery=false,ListenerHandoff=true".
+func (g *FeatureGate) Set(value string) error {
+	g.Lock()
+	defer g.Unlock()
+
+	for _, s := range strings.Split(value, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+
+		kv := strings.SplitN(s, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid feature gate %q, expect name=bool", s)
+		}
+		f := Feature(strings.TrimSpace(kv[0]))
+		if _, ok := defaultFeatures[f]; !ok {
+			return fmt.Errorf("unknown feature gate %q, known gates are %s", f, knownFeatures())
+		}
+		v, err := strconv.ParseBool(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return fmt.Errorf("invalid value %q of feature gate %q", kv[1], f)
+		}
+		g.enabled[f] = v
+	}
+
+	return nil
+}
+
+// Enabled returns whether the feature is enabled.
+func (g *FeatureGate) Enabled(f Feature) bool {
+	g.RLock()
+	defer g.RUnlock()
+	return g.enabled[f]
+}
+
+// Enabled returns whether the feature is enabled in DefaultFeatureGate.
+func Enabled(f Feature) bool {
+	return DefaultFeatureGate.Enabled(f)
+}
+
+func knownFeatures() string {
+	names := make([]string, 0, len(defaultFeatures))
+	for f := range defaultFeatures {
+		names = append(names, string(f))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
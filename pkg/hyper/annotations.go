@@ -0,0 +1,94 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+// Annotations on PodSandboxConfig and ContainerConfig recognized by the
+// hyper runtime.
+const (
+	// annotationPrefix is the common prefix of all frakti annotations.
+	annotationPrefix = "io.kubernetes.frakti."
+
+	// podOverheadCPUAnnotation is the cpu overhead of the pod, e.g. "100m".
+	podOverheadCPUAnnotation = annotationPrefix + "pod-overhead.cpu"
+	// podOverheadMemoryAnnotation is the memory overhead of the pod, e.g. "64Mi".
+	podOverheadMemoryAnnotation = annotationPrefix + "pod-overhead.memory"
+
+	// logMaxSizeAnnotation overrides the log rotation size of a container, e.g. "10Mi".
+	logMaxSizeAnnotation = annotationPrefix + "log-max-size"
+	// logMaxFilesAnnotation overrides the max number of log files of a container.
+	logMaxFilesAnnotation = annotationPrefix + "log-max-files"
+	// logDriverAnnotation overrides the log drivers of a sandbox's containers,
+	// e.g. "file,journald".
+	logDriverAnnotation = annotationPrefix + "log-driver"
+
+	// guestArchAnnotation is the requested guest architecture of a sandbox, e.g. "arm64".
+	guestArchAnnotation = annotationPrefix + "guest-arch"
+	// runtimeHandlerAnnotation is the runtime handler (RuntimeClass) of a sandbox.
+	runtimeHandlerAnnotation = annotationPrefix + "runtime-handler"
+
+	// netDatapathAnnotation is the network datapath of a sandbox, e.g. "virtio".
+	netDatapathAnnotation = annotationPrefix + "net-datapath"
+	// netQueuesAnnotation is the number of virtio-net queues of a sandbox.
+	netQueuesAnnotation = annotationPrefix + "net-queues"
+	// netMTUAnnotation is the MTU of the sandbox network interface.
+	netMTUAnnotation = annotationPrefix + "net-mtu"
+	// netTxQueueLenAnnotation is the TX queue length of the sandbox network interface.
+	netTxQueueLenAnnotation = annotationPrefix + "net-txqueuelen"
+	// netOffloadsAnnotation is the comma separated offload features of the
+	// sandbox network interface, e.g. "tso=off,gso=off".
+	netOffloadsAnnotation = annotationPrefix + "net-offloads"
+	// allowMetadataAccessAnnotation allows a sandbox to reach the link-local
+	// metadata endpoint if "true".
+	allowMetadataAccessAnnotation = annotationPrefix + "allow-metadata-access"
+	// blkioReadBpsAnnotation, blkioWriteBpsAnnotation, blkioReadIOPSAnnotation
+	// and blkioWriteIOPSAnnotation are the block IO limits of a container.
+	blkioReadBpsAnnotation   = annotationPrefix + "blkio-read-bps"
+	blkioWriteBpsAnnotation  = annotationPrefix + "blkio-write-bps"
+	blkioReadIOPSAnnotation  = annotationPrefix + "blkio-read-iops"
+	blkioWriteIOPSAnnotation = annotationPrefix + "blkio-write-iops"
+	// shmSizeAnnotation is the size of /dev/shm of a sandbox, e.g. "64Mi".
+	shmSizeAnnotation = annotationPrefix + "shm-size"
+	// ulimitsAnnotation is the comma separated rlimits of a container, e.g.
+	// "nofile=65536:65536,nproc=4096".
+	ulimitsAnnotation = annotationPrefix + "ulimits"
+	// devicesAnnotation is the comma separated devices of a container with
+	// cgroup permissions, e.g. "/dev/fuse:rwm". Wildcards are allowed in paths.
+	devicesAnnotation = annotationPrefix + "devices"
+	// staticIPAnnotation is the static IP in CIDR of a sandbox, e.g. "10.0.0.5/24".
+	staticIPAnnotation = annotationPrefix + "static-ip"
+	// staticMACAnnotation is the static MAC of a sandbox.
+	staticMACAnnotation = annotationPrefix + "static-mac"
+	// staticGatewayAnnotation is the gateway used with the static IP of a sandbox.
+	staticGatewayAnnotation = annotationPrefix + "static-gateway"
+	// deletionProtectionAnnotation protects a sandbox from DeletePodSandbox
+	// if "true", it could only be deleted via the admin API.
+	deletionProtectionAnnotation = annotationPrefix + "deletion-protection"
+	// dryRunAnnotation validates a sandbox or container creation and reports
+	// what would be created without creating anything if "true". Passed dry
+	// runs succeed with an empty ID and the report in the "frakti-dry-run"
+	// response trailer.
+	dryRunAnnotation = annotationPrefix + "dry-run"
+	// timezoneAnnotation is the time zone of a sandbox's containers, e.g.
+	// "Europe/Berlin", or "host" for the host time zone.
+	timezoneAnnotation = annotationPrefix + "timezone"
+	// kernelModulesAnnotation is the comma separated guest kernel modules
+	// requested by a sandbox, e.g. "nfs,ip_vs".
+	kernelModulesAnnotation = annotationPrefix + "kernel-modules"
+	// mountPropagationAnnotation is the comma separated mount propagation
+	// modes of a container's mounts, e.g. "/data=HostToContainer".
+	mountPropagationAnnotation = annotationPrefix + "mount-propagation"
+)
@@ -0,0 +1,238 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+const (
+	// defaultTokenExpiry is used if the registry doesn't report token expiry.
+	defaultTokenExpiry = 60 * time.Second
+	// tokenExpiryMargin is subtracted from token expiry to avoid using
+	// tokens about to expire.
+	tokenExpiryMargin = 5 * time.Second
+	registryTimeout   = 30 * time.Second
+)
+
+type cachedToken struct {
+	token     string
+	expiresAt time.Time
+}
+
+// authCache caches registry bearer tokens per credentials, registry and
+// repository, so sequential pulls from the same private registry reuse
+// tokens instead of re-authenticating for each manifest and layer.
+type authCache struct {
+	sync.Mutex
+	tokens map[string]cachedToken
+	client *http.Client
+	// insecureRegistries are the registries served by plain HTTP.
+	insecureRegistries []string
+}
+
+func newAuthCache(insecureRegistries []string) *authCache {
+	return &authCache{
+		tokens:             make(map[string]cachedToken),
+		client:             &http.Client{Timeout: registryTimeout},
+		insecureRegistries: insecureRegistries,
+	}
+}
+
+// registryURL returns the URL of path on the registry.
+func (c *authCache) registryURL(registry, path string) string {
+	if contains(c.insecureRegistries, registry) {
+		return "http://" + registry + path
+	}
+	return "https://" + registry + path
+}
+
+// cacheKey returns the cache key of the credentials for the repository.
+func cacheKey(registry, remote string, auth *kubeapi.AuthConfig) string {
+	h := sha256.New()
+	for _, v := range []string{auth.GetUsername(), auth.GetPassword(), auth.GetAuth(), auth.GetIdentityToken(), registry, remote} {
+		h.Write([]byte(v))
+		h.Write([]byte{0})
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// token returns a pull token for the repository, from cache if it's not
+// expired. An empty token is returned if the registry doesn't use token auth.
+func (c *authCache) token(repo string, auth *kubeapi.AuthConfig) (string, error) {
+	registry, remote := splitRepository(repo)
+	key := cacheKey(registry, remote, auth)
+
+	c.Lock()
+	cached, ok := c.tokens[key]
+	c.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.token, nil
+	}
+
+	token, expiry, err := c.fetchToken(registry, remote, auth)
+	if err != nil || token == "" {
+		return "", err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	c.tokens[key] = cachedToken{token: token, expiresAt: time.Now().Add(expiry - tokenExpiryMargin)}
+	// drop expired tokens.
+	for k, t := range c.tokens {
+		if time.Now().After(t.expiresAt) {
+			delete(c.tokens, k)
+		}
+	}
+
+	return token, nil
+}
+
+// parseBearerChallenge parses the parameters of WWW-Authenticate bearer
+// challenge. Values may be quoted strings containing commas and escaped
+// characters, e.g. scope="repository:a:pull,push".
+func parseBearerChallenge(header string) map[string]string {
+	params := make(map[string]string)
+	if !strings.HasPrefix(header, "Bearer ") {
+		return params
+	}
+
+	s := strings.TrimPrefix(header, "Bearer ")
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		i := strings.Index(s, "=")
+		if i <= 0 {
+			return params
+		}
+		key := strings.TrimSpace(s[:i])
+		s = strings.TrimLeft(s[i+1:], " \t")
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			value, s = parseQuotedString(s[1:])
+		} else if j := strings.Index(s, ","); j >= 0 {
+			value, s = strings.TrimSpace(s[:j]), s[j+1:]
+		} else {
+			value, s = strings.TrimSpace(s), ""
+		}
+		params[key] = value
+	}
+}
+
+// parseQuotedString parses the quoted string s starts with, after the
+// opening quote, and returns its unescaped value and the rest of s.
+func parseQuotedString(s string) (string, string) {
+	var value []byte
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				value = append(value, s[i])
+			}
+		case '"':
+			return string(value), s[i+1:]
+		default:
+			value = append(value, s[i])
+		}
+	}
+	return string(value), ""
+}
+
+// basicCredentials returns the username and password of the auth config.
+func basicCredentials(auth *kubeapi.AuthConfig) (string, string) {
+	if auth.GetUsername() != "" {
+		return auth.GetUsername(), auth.GetPassword()
+	}
+
+	if decoded, err := base64.StdEncoding.DecodeString(auth.GetAuth()); err == nil {
+		parts := strings.SplitN(string(decoded), ":", 2)
+		if len(parts) == 2 {
+			return parts[0], parts[1]
+		}
+	}
+	return "", ""
+}
+
+// fetchToken fetches a pull token of the repository from the registry's
+// token service, following docker registry v2 token authentication.
+func (c *authCache) fetchToken(registry, remote string, auth *kubeapi.AuthConfig) (string, time.Duration, error) {
+	resp, err := c.client.Get(c.registryURL(registry, "/v2/"))
+	if err != nil {
+		return "", 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		return "", 0, nil
+	}
+
+	challenge := parseBearerChallenge(resp.Header.Get("WWW-Authenticate"))
+	realm, ok := challenge["realm"]
+	if !ok {
+		return "", 0, nil
+	}
+
+	params := url.Values{}
+	params.Set("service", challenge["service"])
+	params.Set("scope", fmt.Sprintf("repository:%s:pull", remote))
+	req, err := http.NewRequest("GET", realm+"?"+params.Encode(), nil)
+	if err != nil {
+		return "", 0, err
+	}
+	if username, password := basicCredentials(auth); username != "" {
+		req.SetBasicAuth(username, password)
+	}
+
+	tokenResp, err := c.client.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer tokenResp.Body.Close()
+	if tokenResp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("token service of %s returned %s", registry, tokenResp.Status)
+	}
+
+	var result struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(tokenResp.Body).Decode(&result); err != nil {
+		return "", 0, err
+	}
+
+	token := result.Token
+	if token == "" {
+		token = result.AccessToken
+	}
+	expiry := defaultTokenExpiry
+	if result.ExpiresIn > 0 {
+		expiry = time.Duration(result.ExpiresIn) * time.Second
+	}
+
+	return token, expiry, nil
+}
@@ -0,0 +1,309 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"runtime"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/hyperhq/hyperd/types"
+)
+
+const (
+	// cadvisorAPIPrefix is the prefix of the served cadvisor API version.
+	cadvisorAPIPrefix = "/api/v1.3/"
+	// cadvisorRootContainer is the parent of all sandbox containers.
+	cadvisorRootContainer = "/frakti"
+)
+
+// The following types are the subset of cadvisor's v1 API types filled from
+// hyperd statistics, with the same JSON field names.
+
+type cadvisorMachineInfo struct {
+	NumCores       int    `json:"num_cores"`
+	MemoryCapacity uint64 `json:"memory_capacity"`
+}
+
+type cadvisorContainerReference struct {
+	Name      string   `json:"name"`
+	Aliases   []string `json:"aliases,omitempty"`
+	Namespace string   `json:"namespace,omitempty"`
+}
+
+type cadvisorContainerInfo struct {
+	cadvisorContainerReference
+	Subcontainers []cadvisorContainerReference `json:"subcontainers,omitempty"`
+	Stats         []*cadvisorContainerStats    `json:"stats,omitempty"`
+}
+
+type cadvisorCPUUsage struct {
+	Total  uint64   `json:"total"`
+	PerCPU []uint64 `json:"per_cpu_usage,omitempty"`
+	User   uint64   `json:"user"`
+	System uint64   `json:"system"`
+}
+
+type cadvisorCPUStats struct {
+	Usage cadvisorCPUUsage `json:"usage"`
+}
+
+type cadvisorMemoryStats struct {
+	Usage      uint64 `json:"usage"`
+	WorkingSet uint64 `json:"working_set"`
+	Failcnt    uint64 `json:"failcnt"`
+}
+
+type cadvisorInterfaceStats struct {
+	Name      string `json:"name"`
+	RxBytes   uint64 `json:"rx_bytes"`
+	RxPackets uint64 `json:"rx_packets"`
+	RxErrors  uint64 `json:"rx_errors"`
+	RxDropped uint64 `json:"rx_dropped"`
+	TxBytes   uint64 `json:"tx_bytes"`
+	TxPackets uint64 `json:"tx_packets"`
+	TxErrors  uint64 `json:"tx_errors"`
+	TxDropped uint64 `json:"tx_dropped"`
+}
+
+type cadvisorNetworkStats struct {
+	Interfaces []cadvisorInterfaceStats `json:"interfaces,omitempty"`
+}
+
+type cadvisorPerDiskStats struct {
+	Major uint64            `json:"major"`
+	Minor uint64            `json:"minor"`
+	Stats map[string]uint64 `json:"stats"`
+}
+
+type cadvisorDiskIoStats struct {
+	IoServiceBytes []cadvisorPerDiskStats `json:"io_service_bytes,omitempty"`
+	IoServiced     []cadvisorPerDiskStats `json:"io_serviced,omitempty"`
+}
+
+type cadvisorFsStats struct {
+	Device    string `json:"device,omitempty"`
+	Limit     uint64 `json:"capacity"`
+	Usage     uint64 `json:"usage"`
+	Available uint64 `json:"available"`
+}
+
+type cadvisorContainerStats struct {
+	Timestamp time.Time             `json:"timestamp"`
+	CPU       *cadvisorCPUStats     `json:"cpu,omitempty"`
+	Memory    *cadvisorMemoryStats  `json:"memory,omitempty"`
+	Network   *cadvisorNetworkStats `json:"network,omitempty"`
+	DiskIo    *cadvisorDiskIoStats  `json:"diskio,omitempty"`
+	Fs        []cadvisorFsStats     `json:"filesystem,omitempty"`
+}
+
+// CadvisorHandler serves the latest collected sandbox statistics by a subset
+// of cadvisor's v1.3 REST API, so that monitoring stacks scraping cadvisor
+// keep working for sandboxes. Sandboxes are named "/frakti/<sandbox ID>", and
+// their containers "/frakti/<sandbox ID>/<container ID>".
+func (h *Runtime) CadvisorHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(cadvisorAPIPrefix+"machine", handleCadvisorMachine)
+	mux.HandleFunc(cadvisorAPIPrefix+"containers/", h.handleCadvisorContainers)
+	mux.HandleFunc(cadvisorAPIPrefix+"subcontainers/", h.handleCadvisorSubcontainers)
+	return mux
+}
+
+func writeCadvisorJSON(w http.ResponseWriter, obj interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(obj); err != nil {
+		glog.Errorf("Encode cadvisor response failed: %v", err)
+	}
+}
+
+func handleCadvisorMachine(w http.ResponseWriter, r *http.Request) {
+	info := cadvisorMachineInfo{NumCores: runtime.NumCPU()}
+	var sysinfo syscall.Sysinfo_t
+	if err := syscall.Sysinfo(&sysinfo); err == nil {
+		info.MemoryCapacity = uint64(sysinfo.Totalram) * uint64(sysinfo.Unit)
+	}
+	writeCadvisorJSON(w, info)
+}
+
+// cadvisorContainers returns the infos of all sandboxes and containers, keyed
+// by their names.
+func (h *Runtime) cadvisorContainers() map[string]*cadvisorContainerInfo {
+	root := &cadvisorContainerInfo{cadvisorContainerReference: cadvisorContainerReference{Name: cadvisorRootContainer}}
+	infos := map[string]*cadvisorContainerInfo{cadvisorRootContainer: root}
+	for podID, sandbox := range h.stats.get() {
+		name := path.Join(cadvisorRootContainer, podID)
+		pod := &cadvisorContainerInfo{
+			cadvisorContainerReference: cadvisorContainerReference{
+				Name:      name,
+				Aliases:   []string{sandbox.pod.Labels[kubernetesPodNameLabel]},
+				Namespace: sandbox.pod.Labels[kubernetesPodNamespaceLabel],
+			},
+			Stats: []*cadvisorContainerStats{{
+				Timestamp: time.Unix(0, sandbox.stats.Timestamp),
+				CPU:       toCadvisorCPUStats(sandbox.stats.Cpu),
+				Memory:    toCadvisorMemoryStats(sandbox.stats.Memory),
+				Network:   toCadvisorNetworkStats(sandbox.stats.Network),
+				DiskIo:    toCadvisorDiskIoStats(sandbox.stats.Block),
+				Fs:        toCadvisorFsStats(sandbox.stats.Filesystem),
+			}},
+		}
+		root.Subcontainers = append(root.Subcontainers, pod.cadvisorContainerReference)
+		infos[name] = pod
+
+		for _, c := range sandbox.stats.ContainersStats {
+			container := &cadvisorContainerInfo{
+				cadvisorContainerReference: cadvisorContainerReference{Name: path.Join(name, c.ContainerID)},
+				Stats: []*cadvisorContainerStats{{
+					Timestamp: time.Unix(0, c.Timestamp),
+					CPU:       toCadvisorCPUStats(c.Cpu),
+					Memory:    toCadvisorMemoryStats(c.Memory),
+					Network:   toCadvisorNetworkStats(c.Network),
+					DiskIo:    toCadvisorDiskIoStats(c.Block),
+					Fs:        toCadvisorFsStats(c.Filesystem),
+				}},
+			}
+			pod.Subcontainers = append(pod.Subcontainers, container.cadvisorContainerReference)
+			infos[container.Name] = container
+		}
+	}
+
+	return infos
+}
+
+// cadvisorContainerName gets the container name from the request path.
+func cadvisorContainerName(r *http.Request, api string) string {
+	name := path.Clean("/" + strings.TrimPrefix(r.URL.Path, cadvisorAPIPrefix+api))
+	if name == "/" {
+		return cadvisorRootContainer
+	}
+	return name
+}
+
+func (h *Runtime) handleCadvisorContainers(w http.ResponseWriter, r *http.Request) {
+	info, ok := h.cadvisorContainers()[cadvisorContainerName(r, "containers")]
+	if !ok {
+		http.Error(w, "unknown container", http.StatusNotFound)
+		return
+	}
+	writeCadvisorJSON(w, info)
+}
+
+func (h *Runtime) handleCadvisorSubcontainers(w http.ResponseWriter, r *http.Request) {
+	name := cadvisorContainerName(r, "subcontainers")
+	infos := h.cadvisorContainers()
+	if _, ok := infos[name]; !ok {
+		http.Error(w, "unknown container", http.StatusNotFound)
+		return
+	}
+
+	result := []*cadvisorContainerInfo{}
+	for n, info := range infos {
+		if n == name || strings.HasPrefix(n, name+"/") {
+			result = append(result, info)
+		}
+	}
+	sort.Sort(cadvisorContainersByName(result))
+	writeCadvisorJSON(w, result)
+}
+
+type cadvisorContainersByName []*cadvisorContainerInfo
+
+func (s cadvisorContainersByName) Len() int           { return len(s) }
+func (s cadvisorContainersByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s cadvisorContainersByName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+
+func toCadvisorCPUStats(stats *types.CpuStats) *cadvisorCPUStats {
+	usage := stats.GetUsage()
+	if usage == nil {
+		return nil
+	}
+	return &cadvisorCPUStats{Usage: cadvisorCPUUsage{
+		Total:  usage.Total,
+		PerCPU: usage.PerCpu,
+		User:   usage.User,
+		System: usage.System,
+	}}
+}
+
+func toCadvisorMemoryStats(stats *types.MemoryStats) *cadvisorMemoryStats {
+	if stats == nil {
+		return nil
+	}
+	return &cadvisorMemoryStats{
+		Usage:      stats.Usage,
+		WorkingSet: stats.WorkingSet,
+		Failcnt:    stats.Failcnt,
+	}
+}
+
+func toCadvisorNetworkStats(stats *types.NetworkStats) *cadvisorNetworkStats {
+	if stats == nil {
+		return nil
+	}
+	network := &cadvisorNetworkStats{}
+	for _, iface := range stats.Interfaces {
+		network.Interfaces = append(network.Interfaces, cadvisorInterfaceStats{
+			Name:      iface.Name,
+			RxBytes:   iface.RxBytes,
+			RxPackets: iface.RxPackets,
+			RxErrors:  iface.RxErrors,
+			RxDropped: iface.RxDropped,
+			TxBytes:   iface.TxBytes,
+			TxPackets: iface.TxPackets,
+			TxErrors:  iface.TxErrors,
+			TxDropped: iface.TxDropped,
+		})
+	}
+	return network
+}
+
+func toCadvisorPerDiskStats(entries []*types.BlkioStatEntry) []cadvisorPerDiskStats {
+	result := make([]cadvisorPerDiskStats, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, cadvisorPerDiskStats{Major: entry.Major, Minor: entry.Minor, Stats: entry.Stat})
+	}
+	return result
+}
+
+func toCadvisorDiskIoStats(stats *types.BlkioStats) *cadvisorDiskIoStats {
+	if stats == nil {
+		return nil
+	}
+	return &cadvisorDiskIoStats{
+		IoServiceBytes: toCadvisorPerDiskStats(stats.IoServiceBytesRecursive),
+		IoServiced:     toCadvisorPerDiskStats(stats.IoServicedRecursive),
+	}
+}
+
+func toCadvisorFsStats(stats []*types.FsStats) []cadvisorFsStats {
+	result := make([]cadvisorFsStats, 0, len(stats))
+	for _, fs := range stats {
+		result = append(result, cadvisorFsStats{
+			Device:    fs.Device,
+			Limit:     fs.Limit,
+			Usage:     fs.Usage,
+			Available: fs.Available,
+		})
+	}
+	return result
+}
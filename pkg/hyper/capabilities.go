@@ -0,0 +1,130 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	// capabilityStats is collecting sandbox statistics by PodStats.
+	capabilityStats = "stats"
+	// capabilityKVM is booting sandbox VMs with KVM acceleration.
+	capabilityKVM = "kvm"
+)
+
+// capabilities tracks frakti capabilities disabled as hyperd or the host
+// doesn't support them, so that they are reported instead of failing calls
+// repeatedly.
+type capabilities struct {
+	sync.RWMutex
+	degraded map[string]bool
+}
+
+func newCapabilities() *capabilities {
+	return &capabilities{
+		degraded: make(map[string]bool),
+	}
+}
+
+// disable disables the capability because of err.
+func (c *capabilities) disable(name string, err error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if !c.degraded[name] {
+		glog.Warningf("Capability %q is disabled as it isn't supported: %v", name, err)
+		c.degraded[name] = true
+	}
+}
+
+func (c *capabilities) enabled(name string) bool {
+	c.RLock()
+	defer c.RUnlock()
+	return !c.degraded[name]
+}
+
+// versionMetadata returns the degraded capabilities as semver build metadata
+// identifiers, e.g. ["degraded", "stats"], or nil if there isn't any.
+func (c *capabilities) versionMetadata() []string {
+	c.RLock()
+	defer c.RUnlock()
+
+	if len(c.degraded) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(c.degraded))
+	for name := range c.degraded {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append([]string{"degraded"}, names...)
+}
+
+// isUnimplemented returns whether err means the hyperd API is unsupported.
+func isUnimplemented(err error) bool {
+	return grpc.Code(err) == codes.Unimplemented
+}
+
+// checkHyperVersion checks hyperd's version isn't older than
+// minimumHyperVersion.
+func checkHyperVersion(version string) error {
+	current, err := parseVersion(version)
+	if err != nil {
+		return err
+	}
+	minimum, err := parseVersion(minimumHyperVersion)
+	if err != nil {
+		return err
+	}
+
+	for i := range minimum {
+		if i >= len(current) || current[i] < minimum[i] {
+			return fmt.Errorf("hyperd version %s is not supported, requires %s or later", version, minimumHyperVersion)
+		}
+		if current[i] > minimum[i] {
+			return nil
+		}
+	}
+	return nil
+}
+
+// parseVersion parses dotted version numbers, e.g. "v0.7.0-rc1" as [0 7 0].
+func parseVersion(version string) ([]int, error) {
+	v := strings.TrimPrefix(version, "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+
+	var numbers []int
+	for _, s := range strings.Split(v, ".") {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version %q", version)
+		}
+		numbers = append(numbers, n)
+	}
+	return numbers, nil
+}
@@ -17,10 +17,14 @@ limitations under the License.
 package hyper
 
 import (
+	"fmt"
+	"io"
 	"time"
 
 	"github.com/hyperhq/hyperd/types"
+	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"k8s.io/frakti/pkg/metrics"
 )
 
 // Client is the gRPC client for hyperd
@@ -42,4 +46,389 @@ func NewClient(server string, timeout time.Duration) (*Client, error) {
 	}, nil
 }
 
-// TODO: implements hyper client
+// getContextWithTimeout returns a context with timeout.
+func getContextWithTimeout(timeout time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// GetVersion gets hyperd's version and API version.
+func (c *Client) GetVersion() (version, apiVersion string, err error) {
+	defer metrics.RecordHyperdOperation("version", time.Now(), &err)
+
+	ctx, cancel := getContextWithTimeout(c.timeout)
+	defer cancel()
+
+	resp, err := c.client.Version(ctx, &types.VersionRequest{})
+	if err != nil {
+		return "", "", err
+	}
+
+	return resp.Version, resp.ApiVersion, nil
+}
+
+// GetInfo gets the system information of hyperd.
+func (c *Client) GetInfo() (info *types.InfoResponse, err error) {
+	defer metrics.RecordHyperdOperation("info", time.Now(), &err)
+
+	ctx, cancel := getContextWithTimeout(c.timeout)
+	defer cancel()
+
+	return c.client.Info(ctx, &types.InfoRequest{})
+}
+
+// CreatePod creates a pod and returns the pod ID.
+func (c *Client) CreatePod(spec *types.UserPod) (podID string, err error) {
+	defer metrics.RecordHyperdOperation("create_pod", time.Now(), &err)
+
+	ctx, cancel := getContextWithTimeout(c.timeout)
+	defer cancel()
+
+	resp, err := c.client.PodCreate(ctx, &types.PodCreateRequest{PodSpec: spec})
+	if err != nil {
+		return "", err
+	}
+
+	return resp.PodID, nil
+}
+
+// StartPod starts a pod by podID and waits at most timeout for the VM booting.
+func (c *Client) StartPod(podID string, timeout time.Duration) (err error) {
+	defer metrics.RecordHyperdOperation("start_pod", time.Now(), &err)
+
+	ctx, cancel := getContextWithTimeout(timeout)
+	defer cancel()
+
+	stream, err := c.client.PodStart(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := stream.Send(&types.PodStartMessage{PodID: podID}); err != nil {
+		return err
+	}
+
+	if _, err := stream.Recv(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RemovePod removes a pod by podID.
+func (c *Client) RemovePod(podID string) (err error) {
+	defer metrics.RecordHyperdOperation("remove_pod", time.Now(), &err)
+
+	ctx, cancel := getContextWithTimeout(c.timeout)
+	defer cancel()
+
+	_, err = c.client.PodRemove(ctx, &types.PodRemoveRequest{PodID: podID})
+	return err
+}
+
+// StopPod stops a pod by podID.
+func (c *Client) StopPod(podID string) (err error) {
+	defer metrics.RecordHyperdOperation("stop_pod", time.Now(), &err)
+
+	ctx, cancel := getContextWithTimeout(c.timeout)
+	defer cancel()
+
+	resp, err := c.client.PodStop(ctx, &types.PodStopRequest{PodID: podID})
+	if err != nil {
+		return err
+	}
+	if resp.Code != 0 {
+		return fmt.Errorf("stop pod %q failed: %s", podID, resp.Cause)
+	}
+
+	return nil
+}
+
+// GetPodInfo gets pod info by podID.
+func (c *Client) GetPodInfo(podID string) (info *types.PodInfo, err error) {
+	defer metrics.RecordHyperdOperation("pod_info", time.Now(), &err)
+
+	ctx, cancel := getContextWithTimeout(c.timeout)
+	defer cancel()
+
+	resp, err := c.client.PodInfo(ctx, &types.PodInfoRequest{PodID: podID})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.PodInfo, nil
+}
+
+// GetContainerInfo gets container info by containerID.
+func (c *Client) GetContainerInfo(containerID string) (info *types.ContainerInfo, err error) {
+	defer metrics.RecordHyperdOperation("container_info", time.Now(), &err)
+
+	ctx, cancel := getContextWithTimeout(c.timeout)
+	defer cancel()
+
+	resp, err := c.client.ContainerInfo(ctx, &types.ContainerInfoRequest{Container: containerID})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.ContainerInfo, nil
+}
+
+// ListPods lists all pods.
+func (c *Client) ListPods() (pods []*types.PodListResult, err error) {
+	defer metrics.RecordHyperdOperation("list_pods", time.Now(), &err)
+
+	ctx, cancel := getContextWithTimeout(c.timeout)
+	defer cancel()
+
+	resp, err := c.client.PodList(ctx, &types.PodListRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.PodList, nil
+}
+
+// GetPodStats gets the resource usage statistics of a pod by podID.
+func (c *Client) GetPodStats(podID string) (stats *types.PodStats, err error) {
+	defer metrics.RecordHyperdOperation("pod_stats", time.Now(), &err)
+
+	ctx, cancel := getContextWithTimeout(c.timeout)
+	defer cancel()
+
+	resp, err := c.client.PodStats(ctx, &types.PodStatsRequest{PodID: podID})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.PodStats, nil
+}
+
+// CreateExec creates exec in specified container and returns the exec ID.
+func (c *Client) CreateExec(containerID string, cmd []string, tty bool) (execID string, err error) {
+	defer metrics.RecordHyperdOperation("create_exec", time.Now(), &err)
+
+	ctx, cancel := getContextWithTimeout(c.timeout)
+	defer cancel()
+
+	req := &types.ExecCreateRequest{
+		ContainerID: containerID,
+		Command:     cmd,
+		Tty:         tty,
+	}
+	resp, err := c.client.ExecCreate(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	return resp.ExecID, nil
+}
+
+// StartExec starts exec in specified container and streams its stdin and
+// stdout until the exec finishes or ctx is canceled.
+//
+// TODO: kill the exec'd process when ctx is canceled. hyperd has no API to
+// signal execs, so only the stream is closed and the process may keep running
+// in the guest until its stdin reaches EOF.
+func (c *Client) StartExec(ctx context.Context, containerID, execID string, stdin io.Reader, stdout io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := c.client.ExecStart(ctx)
+	if err != nil {
+		return err
+	}
+
+	req := &types.ExecStartRequest{
+		ContainerID: containerID,
+		ExecID:      execID,
+	}
+	if err := stream.Send(req); err != nil {
+		return err
+	}
+
+	if stdin != nil {
+		go func() {
+			buf := make([]byte, 32*1024)
+			for {
+				n, err := stdin.Read(buf)
+				if n > 0 {
+					if sendErr := stream.Send(&types.ExecStartRequest{Stdin: buf[:n]}); sendErr != nil {
+						return
+					}
+				}
+				if err != nil {
+					stream.CloseSend()
+					return
+				}
+			}
+		}()
+	}
+
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(resp.Stdout) > 0 {
+			if _, err := stdout.Write(resp.Stdout); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Wait waits for the process of container or exec finishing and returns its
+// exit code.
+func (c *Client) Wait(containerID, processID string, noHang bool) (int32, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req := &types.WaitRequest{
+		Container: containerID,
+		ProcessId: processID,
+		NoHang:    noHang,
+	}
+	resp, err := c.client.Wait(ctx, req)
+	if err != nil {
+		return -1, err
+	}
+
+	return resp.ExitCode, nil
+}
+
+// CreateContainer creates a container in specified pod and returns the container ID.
+func (c *Client) CreateContainer(podID string, spec *types.UserContainer) (containerID string, err error) {
+	defer metrics.RecordHyperdOperation("create_container", time.Now(), &err)
+
+	ctx, cancel := getContextWithTimeout(c.timeout)
+	defer cancel()
+
+	req := &types.ContainerCreateRequest{
+		PodID:         podID,
+		ContainerSpec: spec,
+	}
+	resp, err := c.client.ContainerCreate(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	return resp.ContainerID, nil
+}
+
+// StopContainer stops the container by SIGTERM, and SIGKILL once hyperd's
+// grace period passed.
+func (c *Client) StopContainer(containerID string) (err error) {
+	defer metrics.RecordHyperdOperation("stop_container", time.Now(), &err)
+
+	ctx, cancel := getContextWithTimeout(c.timeout)
+	defer cancel()
+
+	_, err = c.client.ContainerStop(ctx, &types.ContainerStopRequest{ContainerID: containerID})
+	return err
+}
+
+// ContainerLogs streams the logs of specified container since the unix
+// timestamp since (all logs if empty) to out, each line prefixed by its
+// RFC3339Nano timestamp. Receiving is blocked while out is blocked, so a slow
+// writer applies backpressure to hyperd.
+func (c *Client) ContainerLogs(containerID string, follow bool, since string, out io.Writer) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req := &types.ContainerLogsRequest{
+		Container:  containerID,
+		Follow:     follow,
+		Timestamps: true,
+		Since:      since,
+		Stdout:     true,
+		Stderr:     true,
+	}
+	stream, err := c.client.ContainerLogs(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := out.Write(resp.Log); err != nil {
+			return err
+		}
+	}
+}
+
+// ListImages lists the images, including intermediate layers if all is true.
+func (c *Client) ListImages(all bool) (images []*types.ImageInfo, err error) {
+	defer metrics.RecordHyperdOperation("list_images", time.Now(), &err)
+
+	ctx, cancel := getContextWithTimeout(c.timeout)
+	defer cancel()
+
+	resp, err := c.client.ImageList(ctx, &types.ImageListRequest{All: all})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.ImageList, nil
+}
+
+// PullImage pulls an image with the authentication config, the pulling
+// progress is written to out if it isn't nil.
+func (c *Client) PullImage(image, tag string, auth *types.AuthConfig, out io.Writer) (err error) {
+	defer metrics.RecordHyperdOperation("pull_image", time.Now(), &err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req := &types.ImagePullRequest{
+		Image: image,
+		Tag:   tag,
+		Auth:  auth,
+	}
+	stream, err := c.client.ImagePull(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if out != nil {
+			if _, err := out.Write(resp.Data); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// SetPodLabels sets the labels of a pod, replacing all existing labels if
+// override is true, otherwise merging them.
+func (c *Client) SetPodLabels(podID string, labels map[string]string, override bool) (err error) {
+	defer metrics.RecordHyperdOperation("set_pod_labels", time.Now(), &err)
+
+	ctx, cancel := getContextWithTimeout(c.timeout)
+	defer cancel()
+
+	_, err = c.client.SetPodLabels(ctx, &types.PodLabelsRequest{
+		PodID:    podID,
+		Labels:   labels,
+		Override: override,
+	})
+	return err
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"time"
+)
+
+const (
+	defaultSandboxBootTimeout    = 2 * time.Minute
+	defaultAgentHandshakeTimeout = 30 * time.Second
+	sandboxReadyPollingInterval  = 500 * time.Millisecond
+	hyperPodPhaseRunning         = "Running"
+	hyperPodPhasePending         = "Pending"
+	defaultLogMaxFiles           = 5
+	defaultFluentdAddress        = "127.0.0.1:24224"
+	defaultMaxEnvSize            = 1024 * 1024
+)
+
+// Config contains the configurations of hyper runtime.
+type Config struct {
+	// SandboxBootTimeout is the timeout for booting a sandbox VM.
+	SandboxBootTimeout time.Duration
+	// AgentHandshakeTimeout is the timeout for the guest agent of a booted
+	// sandbox VM becoming ready.
+	AgentHandshakeTimeout time.Duration
+	// LogRateLimit is the max bytes per second copied from a container's
+	// output to its log file, 0 means unlimited.
+	LogRateLimit int64
+	// LogMaxSize is the size in bytes a container log file is rotated at,
+	// 0 means never rotate.
+	LogMaxSize int64
+	// LogMaxFiles is the max number of log files kept for a container,
+	// including the current one.
+	LogMaxFiles int
+	// LogDrivers are the default log drivers of containers, valid values
+	// are "file", "journald" and "fluentd".
+	LogDrivers []string
+	// FluentdAddress is the address of fluentd's forward input, a unix
+	// socket path if starts with "/", otherwise a tcp address.
+	FluentdAddress string
+	// RuntimeHandlers are the named sandbox configurations selected by
+	// RuntimeClass. A "default" handler is used for sandboxes not selecting one.
+	RuntimeHandlers map[string]*RuntimeHandler
+	// QoSProfiles maps pod QoS classes to the runtime handlers used by
+	// sandboxes not selecting one.
+	QoSProfiles map[string]string
+	// NamespacePolicies maps kubernetes namespaces to their policies, "*"
+	// for other namespaces.
+	NamespacePolicies map[string]*NamespacePolicy
+	// NetworkHooksDir is the directory of executables run when sandbox
+	// networks are added or removed, empty means disabled.
+	NetworkHooksDir string
+	// NetworkTeardownsFile is the file persisting failed network teardowns,
+	// so that they are retried after frakti restarts, empty means in memory.
+	NetworkTeardownsFile string
+	// BlockMetadataAccess blocks sandboxes from reaching the link-local
+	// metadata endpoint, unless allowed by annotation.
+	BlockMetadataAccess bool
+	// StatsInterval is the interval of collecting sandbox statistics into
+	// metrics, 0 means disabled.
+	StatsInterval time.Duration
+	// CoreDumpDir is the host directory core dumps of containers are routed
+	// to, in a sub-directory per sandbox, empty means disabled.
+	CoreDumpDir string
+	// CoreDumpQuota is the max bytes of core dumps kept per sandbox.
+	CoreDumpQuota int64
+	// MaxEnvSize is the max total size in bytes of environment variables of
+	// a container, 0 means unlimited.
+	MaxEnvSize int
+	// OfflineMode uses local images when pulling them fails, e.g. on edge
+	// nodes without stable registry connectivity.
+	OfflineMode bool
+	// MaxSandboxes and MaxTotalMemoryMB limit the number and the total VM
+	// memory of sandboxes on the node, 0 means unlimited.
+	MaxSandboxes     int
+	MaxTotalMemoryMB int64
+	// RemovalQueueFile is the file persisting sandboxes pending removal.
+	// If set, DeletePodSandbox returns once the removal is queued and the VM
+	// is removed in background, empty means removing synchronously.
+	RemovalQueueFile string
+	// AllowEmulation allows creating sandboxes on nodes without KVM, relying
+	// on the hypervisor falling back to much slower software emulation (TCG).
+	AllowEmulation bool
+	// ResourcePreflight checks the host has enough resources before booting
+	// sandbox VMs, keeping PreflightMarginMB of memory and disk free.
+	ResourcePreflight bool
+	PreflightMarginMB int64
+	// InsecureRegistries are the registries served by plain HTTP, as
+	// configured in hyperd.
+	InsecureRegistries []string
+	// MirroredRegistries are the registries pulled through mirrors configured
+	// in hyperd, which frakti doesn't query directly.
+	MirroredRegistries []string
+}
+
+// isInsecureRegistry returns whether the registry is served by plain HTTP.
+func (c *Config) isInsecureRegistry(registry string) bool {
+	return contains(c.InsecureRegistries, registry)
+}
+
+// isMirroredRegistry returns whether the registry is pulled through mirrors.
+func (c *Config) isMirroredRegistry(registry string) bool {
+	return contains(c.MirroredRegistries, registry)
+}
+
+// NewDefaultConfig creates a Config with default values.
+func NewDefaultConfig() *Config {
+	return &Config{
+		SandboxBootTimeout:    defaultSandboxBootTimeout,
+		AgentHandshakeTimeout: defaultAgentHandshakeTimeout,
+		LogMaxFiles:           defaultLogMaxFiles,
+		LogDrivers:            []string{logDriverFile},
+		FluentdAddress:        defaultFluentdAddress,
+		MaxEnvSize:            defaultMaxEnvSize,
+		PreflightMarginMB:     defaultPreflightMarginMB,
+	}
+}
@@ -0,0 +1,225 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hyperhq/hyperd/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+// buildUserContainer builds hyperd's UserContainer spec from ContainerConfig.
+// Image config is merged by hyperd with docker's semantics: Command overrides
+// the image ENTRYPOINT and clears its CMD, Args overrides the image CMD, an
+// empty WorkingDir means the image WORKDIR, and Envs override the image ENV
+// of the same names.
+//
+// TODO: create missing working directories like docker does. It has to be
+// done in hyperstart, as container rootfs are only mounted inside the VM.
+//
+// TODO: create in-guest tmpfs for memory-backed mounts (e.g. emptyDir with
+// medium Memory) instead of sharing the host tmpfs, once hyperd has a tmpfs
+// volume driver.
+//
+// TODO: add a rootfs strategy attaching images stored as erofs or squashfs
+// block artifacts as read-only virtio-blk devices with a writable overlay.
+// Container rootfs are always prepared by hyperd's graph driver, and hyperd
+// has no such rootfs type yet.
+//
+// TODO: make sure extended attributes, POSIX ACLs and file capabilities
+// (e.g. of setcap binaries) survive the host and guest filesystem layer,
+// e.g. by virtio-fs xattr mapping. How rootfs and volumes are shared with the
+// VM is decided by hyperd's storage driver, not by frakti.
+func buildUserContainer(config *kubeapi.ContainerConfig) (*types.UserContainer, error) {
+	if config == nil {
+		return nil, fmt.Errorf("container config is nil")
+	}
+	if err := validateBlkioLimits(config); err != nil {
+		return nil, err
+	}
+	if err := validateUlimits(config); err != nil {
+		return nil, err
+	}
+	if err := validateDevices(config); err != nil {
+		return nil, err
+	}
+	if err := validateMountPropagation(config); err != nil {
+		return nil, err
+	}
+	if err := validateMounts(config); err != nil {
+		return nil, err
+	}
+
+	envs := make([]*types.EnvironmentVar, 0, len(config.GetEnvs()))
+	for _, kv := range config.GetEnvs() {
+		envs = append(envs, &types.EnvironmentVar{
+			Env:   kv.GetKey(),
+			Value: kv.GetValue(),
+		})
+	}
+
+	return &types.UserContainer{
+		Name:       config.GetName(),
+		Image:      config.GetImage().GetImage(),
+		Workdir:    config.GetWorkingDir(),
+		Tty:        config.GetTty(),
+		Entrypoint: config.GetCommand(),
+		Command:    config.GetArgs(),
+		Envs:       envs,
+		Labels:     config.GetLabels(),
+	}, nil
+}
+
+// validateBlkioLimits checks the block IO limits requested by container
+// annotations.
+//
+// TODO: enforce the limits by guest blkio cgroups or virtio-blk throttling
+// once hyperd's UserContainer could carry them. Until then, containers
+// requesting them are rejected instead of running unthrottled.
+func validateBlkioLimits(config *kubeapi.ContainerConfig) error {
+	annotations := config.GetAnnotations()
+	for _, key := range []string{blkioReadBpsAnnotation, blkioWriteBpsAnnotation, blkioReadIOPSAnnotation, blkioWriteIOPSAnnotation} {
+		v, ok := annotations[key]
+		if !ok {
+			continue
+		}
+
+		limit, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid block IO limit %s=%q", key, v)
+		}
+		return fmt.Errorf("block IO limit %s=%d is not supported", key, limit)
+	}
+
+	return nil
+}
+
+// validateUlimits checks the rlimits requested by container annotation, e.g.
+// "nofile=65536:65536,nproc=4096".
+//
+// TODO: apply the rlimits to container processes once hyperd's UserContainer
+// could carry them. Until then, containers requesting them are rejected
+// instead of failing later on the default limits of the guest.
+func validateUlimits(config *kubeapi.ContainerConfig) error {
+	v, ok := config.GetAnnotations()[ulimitsAnnotation]
+	if !ok {
+		return nil
+	}
+
+	for _, ulimit := range strings.Split(v, ",") {
+		kv := strings.SplitN(ulimit, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return fmt.Errorf("invalid ulimit %q, expect name=soft[:hard]", ulimit)
+		}
+		for _, limit := range strings.SplitN(kv[1], ":", 2) {
+			if _, err := strconv.ParseUint(limit, 10, 64); err != nil {
+				return fmt.Errorf("invalid ulimit %q, expect name=soft[:hard]", ulimit)
+			}
+		}
+	}
+
+	return fmt.Errorf("ulimits %q are not supported", v)
+}
+
+// validateDevices checks the devices requested by container annotation, e.g.
+// "/dev/fuse:rwm,/dev/nvidia*:rw". The runtime API doesn't have a devices
+// field yet.
+//
+// TODO: create the device nodes and device cgroup rules in guest once
+// hyperd's UserContainer could carry them. Host devices are not visible in
+// the VM unless passed through by the hypervisor either.
+//
+// TODO: FUSE needs no passthrough, only /dev/fuse created in the guest and
+// the fuse module in the guest kernel. Provision it behind a namespace policy
+// once hyperstart could create device nodes in containers.
+func validateDevices(config *kubeapi.ContainerConfig) error {
+	v, ok := config.GetAnnotations()[devicesAnnotation]
+	if !ok {
+		return nil
+	}
+
+	for _, device := range strings.Split(v, ",") {
+		parts := strings.SplitN(device, ":", 2)
+		if !strings.HasPrefix(parts[0], "/dev/") {
+			return fmt.Errorf("invalid device %q, expect /dev/path[:permissions]", device)
+		}
+		if len(parts) == 2 && strings.Trim(parts[1], "rwm") != "" {
+			return fmt.Errorf("invalid device permissions %q, expect a combination of r, w and m", parts[1])
+		}
+	}
+
+	return fmt.Errorf("devices %q are not supported", v)
+}
+
+// validateMounts rejects containers with mounts, so that their volumes,
+// secrets and service account tokens aren't silently missing.
+//
+// TODO: map mounts to hyperd volumes. Volumes of a pod are fixed when it is
+// created, and hyperd's UserVolumeReference can't carry the volume detail
+// yet, so volumes of containers created later can't be added.
+func validateMounts(config *kubeapi.ContainerConfig) error {
+	if len(config.GetMounts()) == 0 {
+		return nil
+	}
+
+	return grpc.Errorf(codes.InvalidArgument, "mounts of container %q are not supported, mounting %q needs hyperd to add volumes to created pods",
+		config.GetName(), config.GetMounts()[0].GetContainerPath())
+}
+
+// Mount propagation modes of kubernetes.
+const (
+	mountPropagationPrivate         = "None"
+	mountPropagationHostToContainer = "HostToContainer"
+	mountPropagationBidirectional   = "Bidirectional"
+)
+
+// validateMountPropagation checks the mount propagation modes requested by
+// container annotation, as the runtime API doesn't have a propagation field
+// yet. An UnsupportedMountPropagationError is returned for modes other than
+// None.
+//
+// TODO: support HostToContainer once volumes are shared by virtio-fs, whose
+// exports could follow host mounts. Volumes shared by hyperd don't propagate
+// mounts in either direction, and Bidirectional can't cross the VM boundary.
+func validateMountPropagation(config *kubeapi.ContainerConfig) error {
+	v, ok := config.GetAnnotations()[mountPropagationAnnotation]
+	if !ok || v == "" {
+		return nil
+	}
+
+	for _, item := range strings.Split(v, ",") {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid mount propagation %q, expect containerPath=mode", item)
+		}
+
+		switch parts[1] {
+		case mountPropagationPrivate:
+		case mountPropagationHostToContainer, mountPropagationBidirectional:
+			return &UnsupportedMountPropagationError{ContainerPath: parts[0], Propagation: parts[1]}
+		default:
+			return fmt.Errorf("invalid mount propagation mode %q of %q", parts[1], parts[0])
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/hyperhq/hyperd/types"
+)
+
+const (
+	// coreDumpVolumeName is the name of the sandbox volume core dumps are
+	// written to.
+	coreDumpVolumeName = "frakti-core-dumps"
+	// coreDumpGuestDir is where the core dump volume is mounted in containers.
+	coreDumpGuestDir = "/var/lib/frakti/cores"
+	// coreDumpPattern is the guest kernel.core_pattern.
+	coreDumpPattern = coreDumpGuestDir + "/core.%e.%p.%t"
+	// coreDumpQuotaInterval is the interval of enforcing core dump quota.
+	coreDumpQuotaInterval  = time.Minute
+	coreDumpDirPermissions = 0755
+)
+
+// coreDumpDir returns the host directory of core dumps of the sandbox.
+func (h *Runtime) coreDumpDir(sandboxName string) string {
+	return filepath.Join(h.config.CoreDumpDir, sandboxName)
+}
+
+// addCoreDumpVolume adds the host directory of core dumps as a volume of the
+// sandbox. Directories are kept after sandboxes are removed, so that crashes
+// could still be debugged, until they are removed by the administrator.
+func (h *Runtime) addCoreDumpVolume(userpod *types.UserPod, sandboxName string) error {
+	if h.config.CoreDumpDir == "" {
+		return nil
+	}
+
+	dir := h.coreDumpDir(sandboxName)
+	if err := os.MkdirAll(dir, coreDumpDirPermissions); err != nil {
+		return err
+	}
+
+	userpod.Volumes = append(userpod.Volumes, &types.UserVolume{
+		Name:   coreDumpVolumeName,
+		Source: dir,
+		Driver: "vfs",
+	})
+	return nil
+}
+
+// setupCoreDump routes core dumps of the container to the core dump volume.
+// kernel.core_pattern is global in the guest kernel, which is fine as the
+// volume is mounted at the same path in all containers of the sandbox.
+func (h *Runtime) setupCoreDump(spec *types.UserContainer) {
+	if h.config.CoreDumpDir == "" {
+		return
+	}
+
+	spec.Volumes = append(spec.Volumes, &types.UserVolumeReference{
+		Path:   coreDumpGuestDir,
+		Volume: coreDumpVolumeName,
+	})
+	if spec.Sysctl == nil {
+		spec.Sysctl = make(map[string]string)
+	}
+	spec.Sysctl["kernel.core_pattern"] = coreDumpPattern
+}
+
+// enforceCoreDumpQuota periodically removes the oldest core dumps of each
+// sandbox exceeding CoreDumpQuota.
+func (h *Runtime) enforceCoreDumpQuota() {
+	for range time.Tick(coreDumpQuotaInterval) {
+		dirs, err := ioutil.ReadDir(h.config.CoreDumpDir)
+		if err != nil {
+			glog.Warningf("Read core dump directory %s failed: %v", h.config.CoreDumpDir, err)
+			continue
+		}
+
+		for _, dir := range dirs {
+			if dir.IsDir() {
+				enforceDirQuota(filepath.Join(h.config.CoreDumpDir, dir.Name()), h.config.CoreDumpQuota)
+			}
+		}
+	}
+}
+
+type filesByModTime []os.FileInfo
+
+func (f filesByModTime) Len() int           { return len(f) }
+func (f filesByModTime) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
+func (f filesByModTime) Less(i, j int) bool { return f[i].ModTime().Before(f[j].ModTime()) }
+
+// enforceDirQuota removes the oldest files in dir until their total size
+// doesn't exceed quota.
+func enforceDirQuota(dir string, quota int64) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		glog.Warningf("Read core dump directory %s failed: %v", dir, err)
+		return
+	}
+
+	var total int64
+	for _, f := range files {
+		total += f.Size()
+	}
+
+	sort.Sort(filesByModTime(files))
+	for _, f := range files {
+		if total <= quota {
+			return
+		}
+
+		path := filepath.Join(dir, f.Name())
+		if err := os.Remove(path); err != nil {
+			glog.Warningf("Remove core dump %s failed: %v", path, err)
+			continue
+		}
+		glog.V(3).Infof("Removed core dump %s exceeding quota", path)
+		total -= f.Size()
+	}
+}
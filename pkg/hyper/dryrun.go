@@ -0,0 +1,70 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	"github.com/hyperhq/hyperd/types"
+	"k8s.io/frakti/pkg/runtime"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+// isDryRun returns whether a creation is a dry run. Dry runs which would
+// succeed return a runtime.DryRunResult reporting what would have been
+// created.
+func isDryRun(annotations map[string]string) bool {
+	return annotations[dryRunAnnotation] == "true"
+}
+
+// dryRunSandbox checks the quota of a validated sandbox and reports the VM
+// it would boot.
+func (h *Runtime) dryRunSandbox(config *kubeapi.PodSandboxConfig, handler *RuntimeHandler, userpod *types.UserPod) error {
+	h.quotaLock.Lock()
+	err := h.enforceSandboxQuota(config, userpod.Resource.Memory)
+	h.quotaLock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	glog.V(3).Infof("Dry run of sandbox %q succeeded", config.GetName())
+	return &runtime.DryRunResult{Report: fmt.Sprintf(
+		"sandbox %q would be created with runtime handler %q, %d vcpus and %dMB memory",
+		config.GetName(), handler.name, userpod.Resource.Vcpu, userpod.Resource.Memory)}
+}
+
+// dryRunContainer resolves the image of a validated container and reports
+// the container it would create.
+func (h *Runtime) dryRunContainer(podSandBoxID string, container *types.UserContainer) error {
+	if _, err := h.client.GetPodInfo(podSandBoxID); err != nil {
+		return err
+	}
+
+	exists, err := h.ImageExists(container.Image)
+	if err != nil {
+		return err
+	}
+	image := "present locally"
+	if !exists {
+		image = "not present locally"
+	}
+
+	glog.V(3).Infof("Dry run of container %q succeeded", container.Name)
+	return &runtime.DryRunResult{Report: fmt.Sprintf("container %q would be created in sandbox %q with image %q (%s)",
+		container.Name, podSandBoxID, container.Image, image)}
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+)
+
+const (
+	// reasonVMBootTimeout means the sandbox VM didn't boot in time.
+	reasonVMBootTimeout = "VMBootTimeout"
+	// reasonAgentHandshakeTimeout means the guest agent didn't become ready in time.
+	reasonAgentHandshakeTimeout = "AgentHandshakeTimeout"
+	// reasonVMExited means the sandbox VM exited unexpectedly.
+	reasonVMExited = "VMExited"
+)
+
+// SandboxNotReadyError is returned when a sandbox VM never becomes ready.
+//
+// TODO: attach the tail of the guest console (e.g. kernel panics) to the error
+// once hyperd exposes VM console output. Today it's only consumed by runv
+// inside hyperd and never persisted or returned by its API.
+type SandboxNotReadyError struct {
+	PodID  string
+	Reason string
+	Err    error
+}
+
+// Error implements the error interface.
+func (e *SandboxNotReadyError) Error() string {
+	return fmt.Sprintf("%s: sandbox %q is not ready: %v", e.Reason, e.PodID, e.Err)
+}
+
+// UnsupportedMountPropagationError is returned when a container requests a
+// mount propagation mode which can't cross the host and guest boundary.
+type UnsupportedMountPropagationError struct {
+	ContainerPath string
+	Propagation   string
+}
+
+// Error implements the error interface.
+func (e *UnsupportedMountPropagationError) Error() string {
+	return fmt.Sprintf("mount propagation %s of %q is not supported, only %s is available",
+		e.Propagation, e.ContainerPath, mountPropagationPrivate)
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+// Exec execute a command in the container. Without TTY, stdout and stderr
+// are kept as distinct streams, and both of them are closed before the exit
+// code is reported, so that all output is delivered before the exec finishes.
+func (h *Runtime) Exec(ctx context.Context, rawContainerID string, cmd []string, tty bool, stdin io.Reader, stdout, stderr io.WriteCloser) error {
+	execID, err := h.client.CreateExec(rawContainerID, cmd, tty)
+	if err != nil {
+		glog.Errorf("Create exec for container %q failed: %v", rawContainerID, err)
+		return err
+	}
+
+	// TTY merges stdout and stderr, otherwise they are multiplexed by hyperd.
+	var output io.Writer = stdout
+	if !tty {
+		output = newStdDemuxWriter(stdout, stderr)
+	}
+
+	err = h.client.StartExec(ctx, rawContainerID, execID, stdin, output)
+	stdout.Close()
+	stderr.Close()
+	if err != nil {
+		glog.Errorf("Start exec for container %q failed: %v", rawContainerID, err)
+		return err
+	}
+
+	exitCode, err := h.client.Wait(rawContainerID, execID, false)
+	if err != nil {
+		glog.Errorf("Wait exec %q of container %q failed: %v", execID, rawContainerID, err)
+		return err
+	}
+
+	if exitCode != 0 {
+		return fmt.Errorf("command '%v' exited with %d", cmd, exitCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/hyperhq/hyperd/types"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+const (
+	// metadataAddress is the link-local metadata endpoint of cloud providers.
+	metadataAddress = "169.254.169.254"
+)
+
+// metadataFirewallChains are the chains blocking metadata access, INPUT for
+// node-local metadata proxies and FORWARD for routed access.
+var metadataFirewallChains = []string{"INPUT", "FORWARD"}
+
+// metadataFirewallRule returns the iptables rule blocking podIP from reaching
+// the metadata endpoint.
+func metadataFirewallRule(podIP string) []string {
+	return []string{
+		"-s", podIP, "-d", metadataAddress,
+		"-m", "comment", "--comment", "frakti metadata protection",
+		"-j", "DROP",
+	}
+}
+
+func iptables(args ...string) error {
+	output, err := exec.Command("iptables", append([]string{"-w"}, args...)...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("iptables %s failed: %v, output: %s", strings.Join(args, " "), err, output)
+	}
+	return nil
+}
+
+// podIPs returns the IPs of a pod without prefix length.
+func podIPs(info *types.PodInfo) []string {
+	if info.Status == nil {
+		return nil
+	}
+
+	ips := make([]string, 0, len(info.Status.PodIP))
+	for _, ip := range info.Status.PodIP {
+		ips = append(ips, strings.SplitN(ip, "/", 2)[0])
+	}
+	return ips
+}
+
+// setupMetadataFirewall blocks the sandbox from reaching the metadata
+// endpoint, unless it's allowed by annotation. It fails rather than leaving
+// the sandbox unprotected, e.g. if the sandbox has no IPs yet, and rules
+// inserted before a failure are removed.
+func (h *Runtime) setupMetadataFirewall(podID string, config *kubeapi.PodSandboxConfig) error {
+	if !h.config.BlockMetadataAccess || config.GetAnnotations()[allowMetadataAccessAnnotation] == "true" {
+		return nil
+	}
+
+	info, err := h.client.GetPodInfo(podID)
+	if err != nil {
+		return err
+	}
+
+	ips := podIPs(info)
+	if len(ips) == 0 {
+		return fmt.Errorf("sandbox %q has no IPs to block metadata access of", podID)
+	}
+	for _, ip := range ips {
+		for _, chain := range metadataFirewallChains {
+			rule := metadataFirewallRule(ip)
+			if iptables(append([]string{"-C", chain}, rule...)...) == nil {
+				continue
+			}
+			if err := iptables(append([]string{"-I", chain}, rule...)...); err != nil {
+				cleanupMetadataFirewall(ips)
+				return err
+			}
+		}
+	}
+
+	glog.V(4).Infof("Blocked metadata access of sandbox %q with IPs %v", podID, ips)
+	return nil
+}
+
+// cleanupMetadataFirewall removes the metadata firewall rules of ips.
+func cleanupMetadataFirewall(ips []string) {
+	for _, ip := range ips {
+		for _, chain := range metadataFirewallChains {
+			rule := metadataFirewallRule(ip)
+			// Rules are only checked for existence, as sandboxes allowed
+			// metadata access don't have them.
+			if iptables(append([]string{"-C", chain}, rule...)...) != nil {
+				continue
+			}
+			if err := iptables(append([]string{"-D", chain}, rule...)...); err != nil {
+				glog.Warningf("Remove metadata firewall rule of %s failed: %v", ip, err)
+			}
+		}
+	}
+}
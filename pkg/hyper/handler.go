@@ -0,0 +1,168 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+// defaultRuntimeHandler is the runtime handler of sandboxes not selecting one.
+const defaultRuntimeHandler = "default"
+
+// RuntimeHandler is a named sandbox configuration, selected by sandboxes via
+// RuntimeClass, so that a node could offer distinct VM configurations.
+//
+// TODO: add device classes (e.g. RDMA HCAs or their virtual functions) passed
+// through to the VMs of a handler, once hyperd supports PCI passthrough.
+// Likewise, a rate limited virtio-rng device with a per-pod opt-out needs
+// hyperd to configure the device per VM. A swap policy, locking or
+// preallocating VM memory for Guaranteed pods while allowing bounded swap for
+// Burstable ones, needs hyperd to expose the memory backend options of VMs or
+// the cgroups of hypervisor processes.
+type RuntimeHandler struct {
+	// DefaultCPU and DefaultMemoryMB size the VMs of sandboxes without limits.
+	DefaultCPU      int32 `json:"defaultCPU"`
+	DefaultMemoryMB int32 `json:"defaultMemoryMB"`
+	// MaxCPU and MaxMemoryMB reject sandboxes with larger VMs, 0 means unlimited.
+	MaxCPU      int32 `json:"maxCPU"`
+	MaxMemoryMB int32 `json:"maxMemoryMB"`
+	// BootTimeout overrides the sandbox boot timeout, e.g. "30s".
+	BootTimeout string `json:"bootTimeout"`
+	// MemoryEncryption is the memory encryption technology of VMs, valid
+	// values are "sev", "sev-es" and "tdx", empty means none.
+	MemoryEncryption string `json:"memoryEncryption"`
+	// VTPM attaches a virtual TPM to VMs.
+	VTPM bool `json:"vtpm"`
+
+	name        string
+	bootTimeout time.Duration
+}
+
+// complete validates the runtime handler and fills its defaults.
+func (r *RuntimeHandler) complete(config *Config) error {
+	if r.DefaultCPU < 0 || r.DefaultMemoryMB < 0 || r.MaxCPU < 0 || r.MaxMemoryMB < 0 {
+		return fmt.Errorf("resources must not be negative")
+	}
+	if r.DefaultCPU == 0 {
+		r.DefaultCPU = defaultCPUNumber
+	}
+	if r.DefaultMemoryMB == 0 {
+		r.DefaultMemoryMB = defaultMemoryinMegabytes
+	}
+	if r.MaxCPU > 0 && r.DefaultCPU > r.MaxCPU {
+		return fmt.Errorf("defaultCPU %d exceeds maxCPU %d", r.DefaultCPU, r.MaxCPU)
+	}
+	if r.MaxMemoryMB > 0 && r.DefaultMemoryMB > r.MaxMemoryMB {
+		return fmt.Errorf("defaultMemoryMB %d exceeds maxMemoryMB %d", r.DefaultMemoryMB, r.MaxMemoryMB)
+	}
+
+	r.bootTimeout = config.SandboxBootTimeout
+	if r.BootTimeout != "" {
+		timeout, err := time.ParseDuration(r.BootTimeout)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("invalid bootTimeout %q", r.BootTimeout)
+		}
+		r.bootTimeout = timeout
+	}
+
+	return r.validateConfidential()
+}
+
+// validateConfidential checks the confidential computing options.
+//
+// TODO: launch VMs with vTPM and memory encryption, and expose attestation
+// evidence in sandbox status, once hyperd could configure them per VM. Until
+// then handlers requesting them are rejected at startup, so that workloads
+// never run without the protection they select.
+//
+// Secure and measured boot of guest kernels is not supported either, as the
+// kernel and initrd are selected and loaded by hyperd from its own config.
+func (r *RuntimeHandler) validateConfidential() error {
+	switch r.MemoryEncryption {
+	case "":
+	case "sev", "sev-es", "tdx":
+		return fmt.Errorf("memoryEncryption %q is not supported by hyperd", r.MemoryEncryption)
+	default:
+		return fmt.Errorf("invalid memoryEncryption %q", r.MemoryEncryption)
+	}
+
+	if r.VTPM {
+		return fmt.Errorf("vtpm is not supported by hyperd")
+	}
+
+	return nil
+}
+
+// LoadRuntimeHandlers loads runtime handlers from a JSON file mapping handler
+// names to their configurations.
+func LoadRuntimeHandlers(path string) (map[string]*RuntimeHandler, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	handlers := make(map[string]*RuntimeHandler)
+	if err := json.Unmarshal(data, &handlers); err != nil {
+		return nil, fmt.Errorf("parse runtime handlers %s failed: %v", path, err)
+	}
+
+	return handlers, nil
+}
+
+// completeRuntimeHandlers validates the configured runtime handlers and
+// makes sure the default one exists.
+func completeRuntimeHandlers(config *Config) error {
+	if config.RuntimeHandlers == nil {
+		config.RuntimeHandlers = make(map[string]*RuntimeHandler)
+	}
+	if _, ok := config.RuntimeHandlers[defaultRuntimeHandler]; !ok {
+		config.RuntimeHandlers[defaultRuntimeHandler] = &RuntimeHandler{}
+	}
+
+	for name, handler := range config.RuntimeHandlers {
+		handler.name = name
+		if err := handler.complete(config); err != nil {
+			return fmt.Errorf("invalid runtime handler %q: %v", name, err)
+		}
+	}
+
+	return validateQoSProfiles(config)
+}
+
+// runtimeHandler returns the runtime handler selected by the sandbox. Sandboxes
+// not selecting one use the QoS profile of their QoS class if configured.
+func (h *Runtime) runtimeHandler(config *kubeapi.PodSandboxConfig) (*RuntimeHandler, error) {
+	name, ok := config.GetAnnotations()[runtimeHandlerAnnotation]
+	if !ok || name == "" {
+		name = defaultRuntimeHandler
+		if profile, ok := h.config.QoSProfiles[qosClass(config)]; ok {
+			name = profile
+		}
+	}
+
+	handler, ok := h.config.RuntimeHandlers[name]
+	if !ok {
+		return nil, fmt.Errorf("runtime handler %q is not configured", name)
+	}
+
+	return handler, nil
+}
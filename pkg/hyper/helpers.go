@@ -0,0 +1,68 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var memoryUnits = map[string]int64{
+	"Ki": 1 << 10,
+	"Mi": 1 << 20,
+	"Gi": 1 << 30,
+	"K":  1000,
+	"M":  1000 * 1000,
+	"G":  1000 * 1000 * 1000,
+}
+
+// parseCPUMilli parses a cpu quantity (e.g. "250m" or "0.5") into millicores.
+func parseCPUMilli(value string) (int64, error) {
+	if strings.HasSuffix(value, "m") {
+		milli, err := strconv.ParseInt(strings.TrimSuffix(value, "m"), 10, 64)
+		if err != nil || milli < 0 {
+			return 0, fmt.Errorf("invalid cpu quantity %q", value)
+		}
+		return milli, nil
+	}
+
+	cores, err := strconv.ParseFloat(value, 64)
+	if err != nil || cores < 0 {
+		return 0, fmt.Errorf("invalid cpu quantity %q", value)
+	}
+	return int64(cores * 1000), nil
+}
+
+// parseMemoryBytes parses a memory quantity (e.g. "128Mi" or "1048576") into bytes.
+func parseMemoryBytes(value string) (int64, error) {
+	for suffix, multiplier := range memoryUnits {
+		if strings.HasSuffix(value, suffix) {
+			n, err := strconv.ParseInt(strings.TrimSuffix(value, suffix), 10, 64)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("invalid memory quantity %q", value)
+			}
+			return n * multiplier, nil
+		}
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid memory quantity %q", value)
+	}
+	return n, nil
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// networkHookAdd is the event when a sandbox's network is up.
+	networkHookAdd = "add"
+	// networkHookRemove is the event when a sandbox's network is going away.
+	networkHookRemove = "remove"
+	// networkHookResync is the event when a sandbox's network should be
+	// re-validated, e.g. after the host resumed from suspend.
+	networkHookResync = "resync"
+)
+
+// runNetworkHooks runs the executables in NetworkHooksDir in lexical order
+// with the event as the only argument, so that network policy agents could
+// attach their programs to sandbox networks. Sandbox details are passed by
+// environment variables FRAKTI_SANDBOX_ID, FRAKTI_POD_NAMESPACE,
+// FRAKTI_POD_NAME and FRAKTI_POD_IPS.
+//
+// TODO: pass the host-side interface name once hyperd reports it.
+func (h *Runtime) runNetworkHooks(event, podID string, labels map[string]string, podIPs []string) error {
+	if h.config.NetworkHooksDir == "" {
+		return nil
+	}
+
+	hooks, err := filepath.Glob(filepath.Join(h.config.NetworkHooksDir, "*"))
+	if err != nil {
+		return err
+	}
+
+	env := append(os.Environ(),
+		"FRAKTI_SANDBOX_ID="+podID,
+		"FRAKTI_POD_NAMESPACE="+labels[kubernetesPodNamespaceLabel],
+		"FRAKTI_POD_NAME="+labels[kubernetesPodNameLabel],
+		"FRAKTI_POD_IPS="+strings.Join(podIPs, ","),
+	)
+	for _, hook := range hooks {
+		cmd := exec.Command(hook, event)
+		cmd.Env = env
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("network hook %s %s for sandbox %q failed: %v, output: %s", hook, event, podID, err, output)
+		}
+		glog.V(4).Infof("Network hook %s %s for sandbox %q succeeded", hook, event, podID)
+	}
+
+	return nil
+}
+
+// sandboxNetworkAdded runs the network hooks of a started sandbox. The
+// sandbox should be removed if any hook fails, so policies are never bypassed.
+//
+// TODO: sandbox networks are set up by hyperd itself rather than by CNI
+// plugins, so there are no CNI results to cache or CHECK yet. Persist the
+// ADD results and verify them on PodSandboxStatus once frakti drives CNI.
+func (h *Runtime) sandboxNetworkAdded(podID string, labels map[string]string) error {
+	if h.config.NetworkHooksDir == "" {
+		return nil
+	}
+
+	info, err := h.client.GetPodInfo(podID)
+	if err != nil {
+		return err
+	}
+
+	var podIPs []string
+	if info.Status != nil {
+		podIPs = info.Status.PodIP
+	}
+	return h.runNetworkHooks(networkHookAdd, podID, labels, podIPs)
+}
@@ -18,10 +18,14 @@ package hyper
 
 import (
 	"fmt"
-	"io"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang/glog"
+	"github.com/hyperhq/hyperd/types"
+	"k8s.io/frakti/pkg/features"
+	"k8s.io/frakti/pkg/metrics"
 	kubeapi "k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
 )
 
@@ -35,40 +39,314 @@ const (
 
 // Runtime is the HyperContainer implementation of kubelet runtime API
 type Runtime struct {
-	client *Client
+	client           *Client
+	config           *Config
+	authCache        *authCache
+	staticAddresses  *staticAddresses
+	networkTeardowns *networkTeardowns
+	stats            *statsCache
+	monitor          *sandboxMonitor
+	capabilities     *capabilities
+	offlinePulls     *offlinePulls
+	imagePlatforms   *imagePlatforms
+	removals         *removalQueue
+	sandboxMemory    *sandboxMemory
+	sandboxChanges   *sandboxChanges
+	// quotaLock serializes quota checks and creations of sandboxes limited by
+	// a quota.
+	quotaLock sync.Mutex
+	// preflightLock guards preflightMemoryMB, the memory reserved by
+	// sandboxes which passed the preflight but haven't booted yet.
+	preflightLock     sync.Mutex
+	preflightMemoryMB int64
 }
 
 // NewHyperRuntime creates a new Runtime
-func NewHyperRuntime(hyperEndpoint string) (*Runtime, error) {
+func NewHyperRuntime(hyperEndpoint string, config *Config) (*Runtime, error) {
+	if err := completeRuntimeHandlers(config); err != nil {
+		return nil, err
+	}
+	if err := validateLogDrivers(config.LogDrivers); err != nil {
+		return nil, err
+	}
+
 	hyperClient, err := NewClient(hyperEndpoint, hyperConnectionTimeout)
 	if err != nil {
 		glog.Fatalf("Initialize hyper client failed: %v", err)
 		return nil, err
 	}
 
-	return &Runtime{client: hyperClient}, nil
+	version, _, err := hyperClient.GetVersion()
+	if err != nil {
+		glog.Errorf("Get hyperd version failed: %v", err)
+		return nil, err
+	}
+	if err := checkHyperVersion(version); err != nil {
+		return nil, err
+	}
+
+	rt := &Runtime{
+		client:          hyperClient,
+		config:          config,
+		authCache:       newAuthCache(config.InsecureRegistries),
+		staticAddresses: newStaticAddresses(),
+		stats:           newStatsCache(),
+		monitor:         newSandboxMonitor(),
+		capabilities:    newCapabilities(),
+		offlinePulls:    newOfflinePulls(),
+		imagePlatforms:  newImagePlatforms(),
+		sandboxMemory:   newSandboxMemory(),
+		sandboxChanges:  newSandboxChanges(),
+	}
+	if rt.networkTeardowns, err = newNetworkTeardowns(config.NetworkTeardownsFile); err != nil {
+		glog.Errorf("Load network teardowns from %s failed: %v", config.NetworkTeardownsFile, err)
+		return nil, err
+	}
+	rt.checkVirtualization()
+	if pods, err := hyperClient.ListPods(); err != nil {
+		glog.Warningf("List pods for restoring static addresses failed: %v", err)
+	} else {
+		rt.staticAddresses.restore(pods)
+	}
+	if config.NetworkHooksDir != "" {
+		go rt.retryNetworkTeardowns()
+	}
+	if config.StatsInterval > 0 {
+		go rt.collectStats()
+	}
+	if features.Enabled(features.SandboxCrashRecovery) {
+		go rt.monitorSandboxes()
+	}
+	go rt.watchHostResume()
+	if config.OfflineMode {
+		go rt.retryOfflinePulls()
+	}
+	if config.CoreDumpDir != "" {
+		go rt.enforceCoreDumpQuota()
+	}
+	if config.RemovalQueueFile != "" {
+		if rt.removals, err = newRemovalQueue(config.RemovalQueueFile); err != nil {
+			glog.Errorf("Load removal queue from %s failed: %v", config.RemovalQueueFile, err)
+			return nil, err
+		}
+		go rt.processRemovals()
+	}
+
+	return rt, nil
 }
 
-// Version returns the runtime name, runtime version and runtime API version
+// Version returns the runtime name, runtime version and runtime API version.
+// The supported image platform, and capabilities disabled as hyperd doesn't
+// support them, are reported in the runtime version as build metadata, e.g.
+// "0.7.0+platform.linux-amd64.degraded.stats".
 func (h *Runtime) Version() (string, string, string, error) {
-	return hyperRuntimeName, "", "", fmt.Errorf("Not implemented")
+	version, apiVersion, err := h.client.GetVersion()
+	if err != nil {
+		glog.Errorf("Get hyperd version failed: %v", err)
+		return "", "", "", err
+	}
+
+	metadata := append([]string{"platform", strings.Replace(supportedPlatform(), "/", "-", -1)},
+		h.capabilities.versionMetadata()...)
+	return hyperRuntimeName, version + "+" + strings.Join(metadata, "."), apiVersion, nil
 }
 
 // CreatePodSandbox creates a pod-level sandbox.
 func (h *Runtime) CreatePodSandbox(config *kubeapi.PodSandboxConfig) (string, error) {
-	return "", fmt.Errorf("Not implemented")
+	timer := newPhaseTimer(metrics.SandboxCreationLatency)
+	if err := validatePodSandboxConfig(config); err != nil {
+		glog.Errorf("Validate sandbox config failed: %v", err)
+		return "", err
+	}
+
+	if err := h.virtualizationError(); err != nil {
+		glog.Errorf("Create sandbox %q failed: %v", config.GetName(), err)
+		return "", err
+	}
+	timer.mark("validate")
+
+	handler, err := h.runtimeHandler(config)
+	if err != nil {
+		glog.Errorf("Get runtime handler for sandbox %q failed: %v", config.GetName(), err)
+		return "", err
+	}
+
+	userpod, err := buildUserPod(config, handler)
+	if err != nil {
+		glog.Errorf("Build UserPod for sandbox %q failed: %v", config.GetName(), err)
+		return "", err
+	}
+	timer.mark("build_spec")
+
+	err = h.enforceSandboxPolicy(config, handler.name, userpod.Resource.Vcpu, userpod.Resource.Memory)
+	if err != nil {
+		glog.Errorf("Sandbox %q violates namespace policy: %v", config.GetName(), err)
+		return "", err
+	}
+
+	if h.config.ResourcePreflight {
+		release, err := h.preflightSandbox(userpod.Resource.Vcpu, userpod.Resource.Memory)
+		if err != nil {
+			glog.Errorf("Preflight of sandbox %q failed: %v", config.GetName(), err)
+			return "", err
+		}
+		defer release()
+	}
+	timer.mark("admission")
+
+	if isDryRun(config.GetAnnotations()) {
+		return "", h.dryRunSandbox(config, handler, userpod)
+	}
+
+	if err := h.addCoreDumpVolume(userpod, config.GetName()); err != nil {
+		glog.Errorf("Add core dump volume for sandbox %q failed: %v", config.GetName(), err)
+		return "", err
+	}
+
+	iface, err := h.staticAddresses.reserve(userpod.Id, config)
+	if err != nil {
+		glog.Errorf("Reserve static addresses for sandbox %q failed: %v", config.GetName(), err)
+		return "", err
+	}
+	if iface != nil {
+		userpod.Interfaces = []*types.UserInterface{iface}
+		addStaticAddressLabels(userpod, iface)
+	}
+	defer func() {
+		if err != nil {
+			h.staticAddresses.release(userpod.Id)
+		}
+	}()
+	timer.mark("prepare")
+
+	podID, err := h.createPod(config, userpod)
+	if err != nil {
+		glog.Errorf("Create pod for sandbox %q failed: %v", config.GetName(), err)
+		return "", err
+	}
+	timer.mark("create")
+
+	err = h.startSandbox(podID, handler.bootTimeout)
+	started := err == nil
+	if started {
+		timer.mark("start")
+		err = h.sandboxNetworkAdded(podID, config.GetLabels())
+	}
+	if err == nil {
+		err = h.setupMetadataFirewall(podID, config)
+	}
+	if err != nil {
+		glog.Errorf("Start pod %q failed: %v", podID, err)
+		if started {
+			// Hooks may have partially set up the network before failing.
+			h.teardownSandboxNetwork(podID, config.GetLabels())
+		}
+		h.monitor.expectStop(podID)
+		if removeError := h.client.RemovePod(podID); removeError != nil {
+			glog.Warningf("Remove pod %q failed: %v", podID, removeError)
+		}
+		return "", err
+	}
+	timer.mark("network")
+	timer.done(fmt.Sprintf("Creating sandbox %q", podID))
+
+	return podID, nil
+}
+
+// createPod creates the pod of a sandbox if it doesn't exceed the quota.
+func (h *Runtime) createPod(config *kubeapi.PodSandboxConfig, userpod *types.UserPod) (string, error) {
+	if h.hasSandboxQuota(config) {
+		h.quotaLock.Lock()
+		defer h.quotaLock.Unlock()
+
+		if err := h.enforceSandboxQuota(config, userpod.Resource.Memory); err != nil {
+			return "", err
+		}
+	}
+
+	podID, err := h.client.CreatePod(userpod)
+	if err != nil {
+		return "", err
+	}
+	h.sandboxMemory.set(podID, userpod.Resource.Memory)
+	return podID, nil
 }
 
 // StopPodSandbox stops the sandbox. If there are any running containers in the
 // sandbox, they should be force terminated.
 func (h *Runtime) StopPodSandbox(podSandBoxID string) error {
-	return fmt.Errorf("Not implemented")
+	h.monitor.expectStop(podSandBoxID)
+	err := h.client.StopPod(podSandBoxID)
+	if err != nil {
+		glog.Errorf("Stop pod %q failed: %v", podSandBoxID, err)
+		return err
+	}
+
+	return nil
 }
 
 // DeletePodSandbox deletes the sandbox. If there are any running containers in the
 // sandbox, they should be force deleted.
 func (h *Runtime) DeletePodSandbox(podSandBoxID string) error {
-	return fmt.Errorf("Not implemented")
+	if err := h.checkDeletionProtection(podSandBoxID); err != nil {
+		glog.Errorf("Delete pod %q refused: %v", podSandBoxID, err)
+		return err
+	}
+
+	return h.ForceDeletePodSandbox(podSandBoxID)
+}
+
+// ForceDeletePodSandbox deletes the sandbox even if it is protected from
+// deletion.
+func (h *Runtime) ForceDeletePodSandbox(podSandBoxID string) error {
+	h.monitor.expectStop(podSandBoxID)
+	if h.removals != nil {
+		if err := h.removals.add(podSandBoxID); err != nil {
+			glog.Errorf("Queue removal of pod %q failed: %v", podSandBoxID, err)
+			return err
+		}
+		return nil
+	}
+
+	err := h.removeSandbox(podSandBoxID)
+	if err != nil {
+		glog.Errorf("Remove pod %q failed: %v", podSandBoxID, err)
+		return err
+	}
+
+	return nil
+}
+
+// cleanupSandboxNetwork tears down the network hooks and the metadata
+// firewall rules of a sandbox, with info and err from inspecting it.
+func (h *Runtime) cleanupSandboxNetwork(podSandBoxID string, info *types.PodInfo, err error) {
+	if err == nil && info.Spec != nil {
+		h.teardownSandboxNetwork(podSandBoxID, info.Spec.Labels)
+	} else if h.config.NetworkHooksDir != "" && !isPodNotFound(err) {
+		// The teardown is still queued, so that hooks release the network
+		// by the sandbox ID at least.
+		glog.Warningf("Get labels of sandbox %q failed, queued its network teardown: %v", podSandBoxID, err)
+		h.networkTeardowns.add(podSandBoxID, nil)
+	}
+	if err == nil && h.config.BlockMetadataAccess {
+		cleanupMetadataFirewall(podIPs(info))
+	}
+}
+
+// removeSandbox tears down the network and removes the VM of a sandbox.
+func (h *Runtime) removeSandbox(podSandBoxID string) error {
+	info, err := h.client.GetPodInfo(podSandBoxID)
+	h.cleanupSandboxNetwork(podSandBoxID, info, err)
+
+	if err := h.client.RemovePod(podSandBoxID); err != nil {
+		return err
+	}
+
+	if info != nil {
+		h.staticAddresses.release(info.PodName)
+	}
+
+	return nil
 }
 
 // PodSandboxStatus returns the Status of the PodSandbox.
@@ -76,14 +354,104 @@ func (h *Runtime) PodSandboxStatus(podSandBoxID string) (*kubeapi.PodSandboxStat
 	return nil, fmt.Errorf("Not implemented")
 }
 
-// ListPodSandbox returns a list of SandBox.
+// ListPodSandbox returns a list of SandBox. Only sandboxes changed since the
+// time of changedSinceLabel are listed if it's in the label selector.
+//
+// TODO: support delta lists of containers as well, once ListContainers is
+// implemented.
 func (h *Runtime) ListPodSandbox(filter *kubeapi.PodSandboxFilter) ([]*kubeapi.PodSandbox, error) {
-	return nil, fmt.Errorf("Not implemented")
+	since, selector, err := parseChangedSince(filter.GetLabelSelector())
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	pods, err := h.client.ListPods()
+	if err != nil {
+		glog.Errorf("List pods failed: %v", err)
+		return nil, err
+	}
+
+	sandboxes := make([]*kubeapi.PodSandbox, 0, len(pods))
+	for _, pod := range pods {
+		sandboxes = append(sandboxes, toPodSandbox(pod))
+	}
+	h.sandboxChanges.update(sandboxes, now)
+	if since != nil {
+		sandboxes = h.sandboxChanges.since(*since)
+	}
+
+	return filterPodSandboxes(sandboxes, filter, selector), nil
 }
 
 // CreateContainer creates a new container in specified PodSandbox
+//
+// TODO: keep rootfs and mounts of sequentially run containers (e.g. init
+// containers) warm in the VM. Rootfs setup is done by hyperd and hyperstart,
+// which don't provide such a cache yet.
+//
+// TODO: propagate volumes staged on the host by CSI node plugins into the
+// VM, including those mounted after the VM has booted. hyperd only shares
+// volumes declared when the pod is created, and doesn't watch host mount
+// propagation events.
+//
+// TODO: hot-attach volumes to running sandboxes for late-bound PVCs, by
+// hot-plugging virtio devices and having the guest agent mount them into
+// containers. hyperd has no API to add volumes to a running pod.
+//
+// TODO: open stdin of containers with Stdin and TTY from their start, and
+// buffer their early output until the first attach. Nothing can consume such
+// a stream until the runtime API supports attach.
 func (h *Runtime) CreateContainer(podSandBoxID string, config *kubeapi.ContainerConfig, sandboxConfig *kubeapi.PodSandboxConfig) (string, error) {
-	return "", fmt.Errorf("Not implemented")
+	timer := newPhaseTimer(metrics.ContainerCreationLatency)
+	if err := validateContainerConfig(config, h.config.MaxEnvSize); err != nil {
+		glog.Errorf("Validate container config failed: %v", err)
+		return "", err
+	}
+
+	if err := h.enforceContainerPolicy(config, sandboxConfig); err != nil {
+		glog.Errorf("Container %q violates namespace policy: %v", config.GetName(), err)
+		return "", err
+	}
+	timer.mark("validate")
+
+	if err := validateLogDrivers(h.logDrivers(sandboxConfig)); err != nil {
+		glog.Errorf("Create container %q failed: %v", config.GetName(), err)
+		return "", err
+	}
+	if err := h.checkContainerImagePlatform(config.GetImage().GetImage()); err != nil {
+		glog.Errorf("Create container %q failed: %v", config.GetName(), err)
+		return "", err
+	}
+
+	containerSpec, err := buildUserContainer(config)
+	if err != nil {
+		glog.Errorf("Build UserContainer for container %q failed: %v", config.GetName(), err)
+		return "", err
+	}
+	if isDryRun(config.GetAnnotations()) {
+		return "", h.dryRunContainer(podSandBoxID, containerSpec)
+	}
+	h.setupCoreDump(containerSpec)
+	h.addImageConfigLabels(containerSpec)
+	if err := h.setupTimezone(podSandBoxID, containerSpec); err != nil {
+		glog.Errorf("Setup time zone of container %q failed: %v", config.GetName(), err)
+		return "", err
+	}
+	timer.mark("build_spec")
+
+	containerID, err := h.client.CreateContainer(podSandBoxID, containerSpec)
+	if err != nil {
+		glog.Errorf("Create container %q in pod %q failed: %v", config.GetName(), podSandBoxID, err)
+		return "", err
+	}
+	timer.mark("create")
+
+	h.startLogCopier(containerID, config, sandboxConfig)
+	timer.mark("setup_io")
+	timer.done(fmt.Sprintf("Creating container %q", containerID))
+
+	return containerID, nil
 }
 
 // StartContainer starts the container.
@@ -92,8 +460,14 @@ func (h *Runtime) StartContainer(rawContainerID string) error {
 }
 
 // StopContainer stops a running container with a grace period (i.e. timeout).
+// The STOPSIGNAL of the container image is honored.
 func (h *Runtime) StopContainer(rawContainerID string, timeout int64) error {
-	return fmt.Errorf("Not implemented")
+	if err := h.stopContainer(rawContainerID, timeout); err != nil {
+		glog.Errorf("Stop container %q failed: %v", rawContainerID, err)
+		return err
+	}
+
+	return nil
 }
 
 // RemoveContainer removes the container. If the container is running, the container
@@ -112,9 +486,22 @@ func (h *Runtime) ContainerStatus(containerID string) (*kubeapi.ContainerStatus,
 	return nil, fmt.Errorf("Not implemented")
 }
 
-// Exec execute a command in the container.
-func (h *Runtime) Exec(rawContainerID string, cmd []string, tty bool, stdin io.Reader, stdout, stderr io.WriteCloser) error {
-	return fmt.Errorf("Not implemented")
+// ContainerNamespace returns the kubernetes namespace of the container, from
+// the labels of the container or else of its sandbox.
+func (h *Runtime) ContainerNamespace(containerID string) (string, error) {
+	info, err := h.client.GetContainerInfo(containerID)
+	if err != nil {
+		return "", err
+	}
+	if namespace := info.GetContainer().GetLabels()[kubernetesPodNamespaceLabel]; namespace != "" {
+		return namespace, nil
+	}
+
+	podInfo, err := h.client.GetPodInfo(info.PodID)
+	if err != nil {
+		return "", err
+	}
+	return podInfo.GetSpec().GetLabels()[kubernetesPodNamespaceLabel], nil
 }
 
 // ListImages lists existing images.
@@ -127,11 +514,6 @@ func (h *Runtime) ImageStatus(image *kubeapi.ImageSpec) (*kubeapi.Image, error)
 	return nil, fmt.Errorf("Not implemented")
 }
 
-// PullImage pulls a image with authentication config.
-func (h *Runtime) PullImage(image *kubeapi.ImageSpec, authConfig *kubeapi.AuthConfig) error {
-	return fmt.Errorf("Not implemented")
-}
-
 // RemoveImage removes the image.
 func (h *Runtime) RemoveImage(image *kubeapi.ImageSpec) error {
 	return fmt.Errorf("Not implemented")
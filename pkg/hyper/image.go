@@ -0,0 +1,158 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"net"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/hyperhq/hyperd/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+const (
+	defaultImageTag = "latest"
+	// defaultRegistry is the registry of images without a registry domain.
+	defaultRegistry = "registry-1.docker.io"
+)
+
+// parseImageName parses image name into repository and tag (or digest).
+func parseImageName(image string) (string, string) {
+	if i := strings.Index(image, "@"); i >= 0 {
+		return image[:i], image[i+1:]
+	}
+
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[:i], image[i+1:]
+	}
+
+	return image, defaultImageTag
+}
+
+// splitRepository splits repository into registry domain and remote name.
+func splitRepository(repo string) (string, string) {
+	parts := strings.SplitN(repo, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return parts[0], parts[1]
+	}
+
+	if len(parts) == 1 {
+		return defaultRegistry, "library/" + repo
+	}
+	return defaultRegistry, repo
+}
+
+// PullImage pulls a image with authentication config. In offline mode, a
+// pull of an image existing locally failed as the registry is unreachable
+// succeeds, and the image is pulled
+// again in background until the registry is reachable.
+//
+// TODO: verify layer digests when rootfs are prepared, and on mismatch
+// quarantine the corrupted layers and pull the image again once. Layers are
+// stored and mounted by hyperd's graph driver, which neither verifies them
+// nor reports corruption distinctly from other errors.
+func (h *Runtime) PullImage(image *kubeapi.ImageSpec, authConfig *kubeapi.AuthConfig) error {
+	err := h.pullImage(image, authConfig)
+	if err == nil || !h.config.OfflineMode || !isRegistryUnreachable(err) {
+		return err
+	}
+
+	exists, listErr := h.ImageExists(image.GetImage())
+	if listErr != nil || !exists {
+		return err
+	}
+
+	glog.Warningf("Pull image %q failed, using the local one in offline mode: %v", image.GetImage(), err)
+	h.offlinePulls.add(image, authConfig)
+	return nil
+}
+
+// registryUnreachableErrors are messages of errors, reported by hyperd as
+// strings, meaning the registry couldn't be reached.
+var registryUnreachableErrors = []string{
+	"dial tcp",
+	"i/o timeout",
+	"no such host",
+	"connection refused",
+	"network is unreachable",
+	"TLS handshake timeout",
+}
+
+// isRegistryUnreachable returns whether a pull failed as the registry couldn't
+// be reached, rather than e.g. being denied or the image not existing.
+func isRegistryUnreachable(err error) bool {
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	if code := grpc.Code(err); code == codes.Unavailable || code == codes.DeadlineExceeded {
+		return true
+	}
+	msg := grpc.ErrorDesc(err)
+	for _, s := range registryUnreachableErrors {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// pullImage pulls a image with authentication config.
+//
+// TODO: pull with a registry client inside frakti (e.g. containerd's
+// resolver), for token auth v2, chunked pulls and OCI artifacts. hyperd has
+// no API to import pulled content into its image store, so pulls still go
+// through hyperd's ImagePull.
+//
+// TODO: support lazily pulled images (e.g. eStargz), starting containers
+// before their layers are fully downloaded. It needs the VM rootfs to fetch
+// chunks on demand, which hyperd's graph driver based rootfs can't do.
+func (h *Runtime) pullImage(image *kubeapi.ImageSpec, authConfig *kubeapi.AuthConfig) error {
+	repo, tag := parseImageName(image.GetImage())
+	if err := h.checkImagePlatform(image.GetImage(), repo, tag, authConfig); err != nil {
+		glog.Errorf("Pull image %q failed: %v", image.GetImage(), err)
+		return err
+	}
+
+	var auth *types.AuthConfig
+	if authConfig != nil {
+		auth = &types.AuthConfig{
+			Username:      authConfig.GetUsername(),
+			Password:      authConfig.GetPassword(),
+			Auth:          authConfig.GetAuth(),
+			Serveraddress: authConfig.GetServerAddress(),
+			Registrytoken: authConfig.GetRegistryToken(),
+		}
+		if auth.Registrytoken == "" {
+			token, err := h.authCache.token(repo, authConfig)
+			if err != nil {
+				glog.Warningf("Get registry token for %q failed, fallback to credentials: %v", repo, err)
+			}
+			auth.Registrytoken = token
+		}
+	}
+
+	err := h.client.PullImage(repo, tag, auth, nil)
+	if err != nil {
+		glog.Errorf("Pull image %q failed: %v", image.GetImage(), err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,43 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+// UpdatePodSandboxLabels updates the labels of a sandbox, which are persisted
+// by hyperd. All existing labels are replaced if override is true, except the
+// deletion protection, otherwise the labels are merged.
+//
+// Containers are not supported, as hyperd doesn't keep labels of containers.
+func (h *Runtime) UpdatePodSandboxLabels(podSandBoxID string, labels map[string]string, override bool) error {
+	if override {
+		info, err := h.client.GetPodInfo(podSandBoxID)
+		if err != nil {
+			return err
+		}
+		if info.Spec != nil && info.Spec.Labels[deletionProtectionLabel] != "" {
+			if _, ok := labels[deletionProtectionLabel]; !ok {
+				updated := make(map[string]string, len(labels)+1)
+				for k, v := range labels {
+					updated[k] = v
+				}
+				updated[deletionProtectionLabel] = info.Spec.Labels[deletionProtectionLabel]
+				labels = updated
+			}
+		}
+	}
+
+	return h.client.SetPodLabels(podSandBoxID, labels, override)
+}
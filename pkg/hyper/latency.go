@@ -0,0 +1,60 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/frakti/pkg/metrics"
+)
+
+// phaseTimer records the latency of each phase of an operation, e.g. the
+// creation of a sandbox, into a histogram labeled by phase.
+type phaseTimer struct {
+	histogram *metrics.HistogramVec
+	start     time.Time
+	last      time.Time
+	phases    []string
+}
+
+func newPhaseTimer(histogram *metrics.HistogramVec) *phaseTimer {
+	now := time.Now()
+	return &phaseTimer{
+		histogram: histogram,
+		start:     now,
+		last:      now,
+	}
+}
+
+// mark ends the current phase, which has run since the previous mark.
+func (t *phaseTimer) mark(phase string) {
+	now := time.Now()
+	elapsed := now.Sub(t.last)
+	t.last = now
+
+	t.histogram.Observe(elapsed.Seconds(), phase)
+	t.phases = append(t.phases, fmt.Sprintf("%s=%v", phase, elapsed))
+}
+
+// done logs the latency breakdown of the operation.
+func (t *phaseTimer) done(operation string) {
+	glog.V(4).Infof("%s took %v: %s", operation, time.Since(t.start), strings.Join(t.phases, " "))
+}
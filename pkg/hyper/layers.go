@@ -0,0 +1,88 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"sort"
+
+	"github.com/hyperhq/hyperd/types"
+	"k8s.io/frakti/pkg/runtime"
+)
+
+// noneTag is the tag of untagged images and intermediate layers.
+const noneTag = "<none>:<none>"
+
+// ListImageLayers lists all layers of hyperd's image store with their disk
+// usage, and how many tagged images share each of them.
+func (h *Runtime) ListImageLayers() ([]*runtime.ImageLayer, error) {
+	images, err := h.client.ListImages(true)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make(map[string]*types.ImageInfo, len(images))
+	for _, info := range images {
+		infos[info.Id] = info
+	}
+
+	layers := make(map[string]*runtime.ImageLayer, len(images))
+	for _, info := range images {
+		layer := &runtime.ImageLayer{
+			ID:       info.Id,
+			ParentID: info.ParentID,
+			Size:     info.VirtualSize,
+		}
+		if parent, ok := infos[info.ParentID]; ok {
+			layer.Size -= parent.VirtualSize
+		}
+		for _, tag := range info.RepoTags {
+			if tag != noneTag {
+				layer.Tags = append(layer.Tags, tag)
+			}
+		}
+		layers[info.Id] = layer
+	}
+
+	for _, layer := range layers {
+		if len(layer.Tags) == 0 {
+			continue
+		}
+		// Walk up the parent chain, bounded in case of a corrupted graph.
+		for id, depth := layer.ID, 0; id != "" && depth < len(layers); depth++ {
+			ancestor, ok := layers[id]
+			if !ok {
+				break
+			}
+			ancestor.SharedBy++
+			id = ancestor.ParentID
+		}
+	}
+
+	result := make([]*runtime.ImageLayer, 0, len(layers))
+	for _, layer := range layers {
+		result = append(result, layer)
+	}
+	sort.Sort(layersBySize(result))
+	return result, nil
+}
+
+// layersBySize sorts layers by size in descending order.
+type layersBySize []*runtime.ImageLayer
+
+func (l layersBySize) Len() int           { return len(l) }
+func (l layersBySize) Less(i, j int) bool { return l[i].Size > l[j].Size }
+func (l layersBySize) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
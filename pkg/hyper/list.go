@@ -0,0 +1,216 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperhq/hyperd/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+const (
+	// changedSinceLabel is a reserved label selector of sandbox lists,
+	// whose value is a unix timestamp in nanoseconds. Only sandboxes changed
+	// since then are listed, including those removed, so that cooperating
+	// clients could relist incrementally. Clients should pass the time they
+	// started their previous list.
+	changedSinceLabel = annotationPrefix + "changed-since"
+	// removedLabel marks sandboxes removed since the time of delta lists,
+	// which are listed as not ready.
+	removedLabel = annotationPrefix + "removed"
+	// sandboxTombstoneRetention is how long removed sandboxes are kept for
+	// delta lists. Clients relisting less often should list all sandboxes.
+	sandboxTombstoneRetention = 10 * time.Minute
+)
+
+// sandboxChange is the last observed change of a sandbox.
+type sandboxChange struct {
+	sandbox     *kubeapi.PodSandbox
+	fingerprint string
+	changedAt   time.Time
+	removed     bool
+}
+
+// sandboxChanges tracks when sandboxes changed, by comparing their state and
+// labels on every list. hyperd reports creation times only, but a change
+// is always observed by the first list after it, so a list since the start of
+// a previous one sees all changes in between.
+type sandboxChanges struct {
+	sync.Mutex
+	changes map[string]*sandboxChange
+}
+
+func newSandboxChanges() *sandboxChanges {
+	return &sandboxChanges{changes: make(map[string]*sandboxChange)}
+}
+
+// update records the current sandboxes observed at now, and marks the
+// missing ones removed.
+func (c *sandboxChanges) update(sandboxes []*kubeapi.PodSandbox, now time.Time) {
+	c.Lock()
+	defer c.Unlock()
+
+	seen := make(map[string]bool, len(sandboxes))
+	for _, sandbox := range sandboxes {
+		seen[sandbox.GetId()] = true
+		fingerprint := sandboxFingerprint(sandbox)
+		if change, ok := c.changes[sandbox.GetId()]; ok && !change.removed && change.fingerprint == fingerprint {
+			change.sandbox = sandbox
+			continue
+		}
+		c.changes[sandbox.GetId()] = &sandboxChange{
+			sandbox:     sandbox,
+			fingerprint: fingerprint,
+			changedAt:   now,
+		}
+	}
+
+	for id, change := range c.changes {
+		switch {
+		case seen[id]:
+		case !change.removed:
+			change.removed = true
+			change.changedAt = now
+		case now.Sub(change.changedAt) > sandboxTombstoneRetention:
+			delete(c.changes, id)
+		}
+	}
+}
+
+// since returns the sandboxes changed since the time, removed ones are
+// returned not ready with removedLabel.
+func (c *sandboxChanges) since(since time.Time) []*kubeapi.PodSandbox {
+	c.Lock()
+	defer c.Unlock()
+
+	var sandboxes []*kubeapi.PodSandbox
+	for id, change := range c.changes {
+		if change.changedAt.Before(since) {
+			continue
+		}
+		if !change.removed {
+			sandboxes = append(sandboxes, change.sandbox)
+			continue
+		}
+
+		labels := make(map[string]string, len(change.sandbox.Labels)+1)
+		for k, v := range change.sandbox.Labels {
+			labels[k] = v
+		}
+		labels[removedLabel] = "true"
+		state := kubeapi.PodSandBoxState_NOTREADY
+		sandboxID := id
+		sandboxes = append(sandboxes, &kubeapi.PodSandbox{
+			Id:        &sandboxID,
+			Name:      change.sandbox.Name,
+			State:     &state,
+			CreatedAt: change.sandbox.CreatedAt,
+			Labels:    labels,
+		})
+	}
+	return sandboxes
+}
+
+// sandboxFingerprint identifies the state and labels of a sandbox.
+func sandboxFingerprint(sandbox *kubeapi.PodSandbox) string {
+	keys := make([]string, 0, len(sandbox.Labels))
+	for k := range sandbox.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := []string{sandbox.GetState().String()}
+	for _, k := range keys {
+		parts = append(parts, k+"="+sandbox.Labels[k])
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// toPodSandbox converts a hyper pod to a sandbox.
+func toPodSandbox(pod *types.PodListResult) *kubeapi.PodSandbox {
+	state := kubeapi.PodSandBoxState_NOTREADY
+	if pod.Status == hyperPodPhaseRunning {
+		state = kubeapi.PodSandBoxState_READY
+	}
+	id, name, createdAt := pod.PodID, pod.PodName, pod.CreatedAt
+	return &kubeapi.PodSandbox{
+		Id:        &id,
+		Name:      &name,
+		State:     &state,
+		CreatedAt: &createdAt,
+		Labels:    pod.Labels,
+	}
+}
+
+// parseChangedSince returns the time of changedSinceLabel in the label
+// selector, and the selector without it.
+func parseChangedSince(selector map[string]string) (*time.Time, map[string]string, error) {
+	v, ok := selector[changedSinceLabel]
+	if !ok {
+		return nil, selector, nil
+	}
+
+	nanos, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || nanos < 0 {
+		return nil, nil, grpc.Errorf(codes.InvalidArgument, "invalid %s %q, expect unix nanoseconds", changedSinceLabel, v)
+	}
+	rest := make(map[string]string, len(selector)-1)
+	for k, v := range selector {
+		if k != changedSinceLabel {
+			rest[k] = v
+		}
+	}
+	since := time.Unix(0, nanos)
+	return &since, rest, nil
+}
+
+// filterPodSandboxes returns the sandboxes matching the filter, with selector
+// in place of its label selector.
+func filterPodSandboxes(sandboxes []*kubeapi.PodSandbox, filter *kubeapi.PodSandboxFilter, selector map[string]string) []*kubeapi.PodSandbox {
+	var matched []*kubeapi.PodSandbox
+	for _, sandbox := range sandboxes {
+		if filter != nil {
+			if (filter.Id != nil && filter.GetId() != sandbox.GetId()) ||
+				(filter.Name != nil && filter.GetName() != sandbox.GetName()) ||
+				(filter.State != nil && filter.GetState() != sandbox.GetState()) {
+				continue
+			}
+		}
+		if !matchLabels(sandbox.Labels, selector) {
+			continue
+		}
+		matched = append(matched, sandbox)
+	}
+	return matched
+}
+
+// matchLabels returns whether labels has all labels of selector.
+func matchLabels(labels, selector map[string]string) bool {
+	for k, v := range selector {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,202 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+const (
+	// logDriverFile writes container output to CRI log files.
+	logDriverFile = "file"
+	// logDriverJournald sends container output to systemd-journald.
+	logDriverJournald = "journald"
+	// logDriverFluentd sends container output to fluentd's forward input.
+	logDriverFluentd = "fluentd"
+
+	journaldSocket = "/run/systemd/journal/socket"
+)
+
+// knownLogDrivers are the supported log drivers.
+var knownLogDrivers = []string{logDriverFile, logDriverJournald, logDriverFluentd}
+
+// validateLogDrivers returns an InvalidArgument error if any of drivers is
+// unknown, so that containers aren't created with their logs dropped.
+func validateLogDrivers(drivers []string) error {
+	for _, driver := range drivers {
+		if !contains(knownLogDrivers, strings.TrimSpace(driver)) {
+			return grpc.Errorf(codes.InvalidArgument, "unknown log driver %q, valid values are %s",
+				driver, strings.Join(knownLogDrivers, ","))
+		}
+	}
+	return nil
+}
+
+// journaldFieldValue returns v without newlines, which would end the field in
+// journald's native protocol.
+func journaldFieldValue(v string) string {
+	return strings.NewReplacer("\n", " ", "\r", " ").Replace(v)
+}
+
+// journaldWriter sends each write as a journal entry via journald's native
+// protocol.
+type journaldWriter struct {
+	conn          net.Conn
+	containerID   string
+	containerName string
+}
+
+func newJournaldWriter(containerID, containerName string) (*journaldWriter, error) {
+	conn, err := net.Dial("unixgram", journaldSocket)
+	if err != nil {
+		return nil, err
+	}
+
+	return &journaldWriter{
+		conn:          conn,
+		containerID:   journaldFieldValue(containerID),
+		containerName: journaldFieldValue(containerName),
+	}, nil
+}
+
+// Write implements io.Writer.
+func (w *journaldWriter) Write(p []byte) (int, error) {
+	var buf bytes.Buffer
+	// MESSAGE may contain newlines, so it is serialized in binary form.
+	buf.WriteString("MESSAGE\n")
+	binary.Write(&buf, binary.LittleEndian, uint64(len(p)))
+	buf.Write(p)
+	fmt.Fprintf(&buf, "\nCONTAINER_ID=%s\nCONTAINER_NAME=%s\n", w.containerID, w.containerName)
+
+	if _, err := w.conn.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close implements io.Closer.
+func (w *journaldWriter) Close() error {
+	return w.conn.Close()
+}
+
+// fluentdWriter sends each write as an event in fluentd forward protocol's
+// JSON form: [tag, time, record].
+type fluentdWriter struct {
+	conn        net.Conn
+	tag         string
+	containerID string
+}
+
+func newFluentdWriter(address, containerID, containerName string) (*fluentdWriter, error) {
+	network := "tcp"
+	if strings.HasPrefix(address, "/") {
+		network = "unix"
+	}
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fluentdWriter{conn: conn, tag: "frakti." + containerName, containerID: containerID}, nil
+}
+
+// Write implements io.Writer.
+func (w *fluentdWriter) Write(p []byte) (int, error) {
+	record := map[string]string{
+		"log":          string(p),
+		"container_id": w.containerID,
+	}
+	event, err := json.Marshal([]interface{}{w.tag, time.Now().Unix(), record})
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := w.conn.Write(event); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close implements io.Closer.
+func (w *fluentdWriter) Close() error {
+	return w.conn.Close()
+}
+
+// logDrivers returns the log drivers of the container, selected by the
+// sandbox annotation or node config, e.g. "file,journald".
+func (h *Runtime) logDrivers(sandboxConfig *kubeapi.PodSandboxConfig) []string {
+	if v, ok := sandboxConfig.GetAnnotations()[logDriverAnnotation]; ok {
+		return strings.Split(v, ",")
+	}
+
+	return h.config.LogDrivers
+}
+
+// logDriverWriter is the writer of a log driver.
+type logDriverWriter struct {
+	io.WriteCloser
+	driver string
+}
+
+// newLogWriters creates the writers of the container's log drivers.
+func (h *Runtime) newLogWriters(containerID string, config *kubeapi.ContainerConfig, sandboxConfig *kubeapi.PodSandboxConfig) ([]*logDriverWriter, error) {
+	var writers []*logDriverWriter
+	closeAll := func() {
+		for _, w := range writers {
+			w.Close()
+		}
+	}
+
+	for _, driver := range h.logDrivers(sandboxConfig) {
+		driver = strings.TrimSpace(driver)
+		var w io.WriteCloser
+		var err error
+		switch driver {
+		case logDriverFile:
+			if config.GetLogPath() == "" || sandboxConfig.GetLogDirectory() == "" {
+				continue
+			}
+			maxSize, maxFiles := h.logRotationOptions(config)
+			w, err = newRotatingFileWriter(filepath.Join(sandboxConfig.GetLogDirectory(), config.GetLogPath()), maxSize, maxFiles)
+		case logDriverJournald:
+			w, err = newJournaldWriter(containerID, config.GetName())
+		case logDriverFluentd:
+			w, err = newFluentdWriter(h.config.FluentdAddress, containerID, config.GetName())
+		default:
+			err = fmt.Errorf("unknown log driver %q", driver)
+		}
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		writers = append(writers, &logDriverWriter{WriteCloser: w, driver: driver})
+	}
+
+	return writers, nil
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/golang/glog"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+// rotatingFileWriter writes to a log file, and rotates it to path.1, path.2,
+// ... once its size exceeds maxSize, keeping at most maxFiles files in total.
+type rotatingFileWriter struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+	file     *os.File
+	size     int64
+}
+
+func newRotatingFileWriter(path string, maxSize int64, maxFiles int) (*rotatingFileWriter, error) {
+	w := &rotatingFileWriter{
+		path:     path,
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (w *rotatingFileWriter) open() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, logFilePermissions)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	w.file = f
+	w.size = info.Size()
+	return nil
+}
+
+// rotate shifts the rotated files and starts a new log file.
+func (w *rotatingFileWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+
+	if w.maxFiles <= 1 {
+		if err := os.Truncate(w.path, 0); err != nil {
+			return err
+		}
+		return w.open()
+	}
+
+	for i := w.maxFiles - 1; i > 0; i-- {
+		src := w.path
+		if i > 1 {
+			src = fmt.Sprintf("%s.%d", w.path, i-1)
+		}
+		if err := os.Rename(src, fmt.Sprintf("%s.%d", w.path, i)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return w.open()
+}
+
+// Write implements io.Writer.
+func (w *rotatingFileWriter) Write(p []byte) (int, error) {
+	if w.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Close closes the current log file.
+func (w *rotatingFileWriter) Close() error {
+	return w.file.Close()
+}
+
+// logRotationOptions returns the max size and max files of container log,
+// which could be overridden by container annotations.
+func (h *Runtime) logRotationOptions(config *kubeapi.ContainerConfig) (int64, int) {
+	maxSize, maxFiles := h.config.LogMaxSize, h.config.LogMaxFiles
+
+	annotations := config.GetAnnotations()
+	if v, ok := annotations[logMaxSizeAnnotation]; ok {
+		if size, err := parseMemoryBytes(v); err != nil {
+			glog.Warningf("Ignore invalid annotation %s=%q: %v", logMaxSizeAnnotation, v, err)
+		} else {
+			maxSize = size
+		}
+	}
+	if v, ok := annotations[logMaxFilesAnnotation]; ok {
+		if files, err := strconv.Atoi(v); err != nil || files < 1 {
+			glog.Warningf("Ignore invalid annotation %s=%q", logMaxFilesAnnotation, v)
+		} else {
+			maxFiles = files
+		}
+	}
+
+	return maxSize, maxFiles
+}
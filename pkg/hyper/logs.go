@@ -0,0 +1,331 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/golang/glog"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+const (
+	logFilePermissions = 0640
+	// logStreamStdout and logStreamStderr tag the lines of CRI log files.
+	logStreamStdout = "stdout"
+	logStreamStderr = "stderr"
+	// criLogMaxLineSize is the max bytes buffered for a line without
+	// newline, longer lines are split.
+	criLogMaxLineSize = 16 * 1024
+	// logRetryInterval and logMaxRetries controls re-following logs after
+	// the log stream broke unexpectedly.
+	logRetryInterval = 5 * time.Second
+	logMaxRetries    = 3
+)
+
+// rateLimitedWriter limits the throughput of the underlying writer to
+// bytesPerSecond by blocking writes, 0 means unlimited.
+type rateLimitedWriter struct {
+	w              io.Writer
+	bytesPerSecond int64
+	windowStart    time.Time
+	windowWritten  int64
+}
+
+func newRateLimitedWriter(w io.Writer, bytesPerSecond int64) *rateLimitedWriter {
+	return &rateLimitedWriter{
+		w:              w,
+		bytesPerSecond: bytesPerSecond,
+		windowStart:    time.Now(),
+	}
+}
+
+// Write implements io.Writer.
+func (r *rateLimitedWriter) Write(p []byte) (int, error) {
+	n, err := r.w.Write(p)
+	if r.bytesPerSecond <= 0 {
+		return n, err
+	}
+
+	if time.Since(r.windowStart) > time.Second {
+		r.windowStart = time.Now()
+		r.windowWritten = 0
+	}
+	r.windowWritten += int64(n)
+
+	expected := time.Duration(float64(r.windowWritten) / float64(r.bytesPerSecond) * float64(time.Second))
+	if elapsed := time.Since(r.windowStart); expected > elapsed {
+		time.Sleep(expected - elapsed)
+	}
+
+	return n, err
+}
+
+// criLogWriter writes each line in CRI log format, i.e. the RFC3339Nano
+// timestamp, the stream and the content, e.g.
+// "2016-10-06T00:17:09.669794202Z stdout hello".
+type criLogWriter struct {
+	w      io.Writer
+	stream string
+	buf    []byte
+}
+
+func newCRILogWriter(w io.Writer, stream string) *criLogWriter {
+	return &criLogWriter{w: w, stream: stream}
+}
+
+// Write implements io.Writer. Incomplete lines are buffered until their
+// newline, or until they exceed criLogMaxLineSize.
+func (c *criLogWriter) Write(p []byte) (int, error) {
+	c.buf = append(c.buf, p...)
+	for {
+		end, next := bytes.IndexByte(c.buf, '\n'), 0
+		if end >= 0 {
+			next = end + 1
+		} else if len(c.buf) >= criLogMaxLineSize {
+			end, next = criLogMaxLineSize, criLogMaxLineSize
+		} else {
+			return len(p), nil
+		}
+		if err := c.writeLine(c.buf[:end]); err != nil {
+			return 0, err
+		}
+		c.buf = c.buf[next:]
+	}
+}
+
+func (c *criLogWriter) writeLine(line []byte) error {
+	entry := make([]byte, 0, len(line)+64)
+	entry = append(entry, time.Now().UTC().Format(time.RFC3339Nano)...)
+	entry = append(entry, ' ')
+	entry = append(entry, c.stream...)
+	entry = append(entry, ' ')
+	entry = append(entry, line...)
+	entry = append(entry, '\n')
+	_, err := c.w.Write(entry)
+	return err
+}
+
+// flush writes the buffered incomplete line.
+func (c *criLogWriter) flush() error {
+	if len(c.buf) == 0 {
+		return nil
+	}
+	err := c.writeLine(c.buf)
+	c.buf = nil
+	return err
+}
+
+// logTimestampMaxLen is the max length of timestamps prefixed to log lines
+// by hyperd, longer prefixes are taken as content.
+const logTimestampMaxLen = len(time.RFC3339Nano) + 8
+
+// logCursor is the timestamp of the last complete log line written, which
+// log streams are resumed after.
+type logCursor struct {
+	last time.Time
+}
+
+// since returns the unix timestamp following the last line, or empty if no
+// line has been written.
+func (c *logCursor) since() string {
+	if c.last.IsZero() {
+		return ""
+	}
+	next := c.last.Add(time.Nanosecond)
+	return fmt.Sprintf("%d.%09d", next.Unix(), next.Nanosecond())
+}
+
+// logTimestampWriter strips the timestamps prefixed to log lines by hyperd,
+// and advances the cursor once a line is complete.
+type logTimestampWriter struct {
+	w         io.Writer
+	cursor    *logCursor
+	prefix    []byte
+	inLine    bool
+	timestamp time.Time
+}
+
+func newLogTimestampWriter(w io.Writer, cursor *logCursor) *logTimestampWriter {
+	return &logTimestampWriter{w: w, cursor: cursor}
+}
+
+// Write implements io.Writer.
+func (t *logTimestampWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if !t.inLine {
+			i := bytes.IndexByte(p, ' ')
+			if i < 0 && len(t.prefix)+len(p) <= logTimestampMaxLen {
+				t.prefix = append(t.prefix, p...)
+				return n, nil
+			}
+
+			var content []byte
+			if i >= 0 && len(t.prefix)+i <= logTimestampMaxLen {
+				t.prefix = append(t.prefix, p[:i]...)
+				p = p[i+1:]
+				timestamp, err := time.Parse(time.RFC3339Nano, string(t.prefix))
+				if err != nil {
+					content = append(t.prefix, ' ')
+				}
+				t.timestamp = timestamp
+			} else {
+				// No timestamp, the line is written as is.
+				content = t.prefix
+				t.timestamp = time.Time{}
+			}
+			t.prefix = nil
+			t.inLine = true
+			if len(content) > 0 {
+				if _, err := t.w.Write(content); err != nil {
+					return 0, err
+				}
+			}
+			continue
+		}
+
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			if _, err := t.w.Write(p); err != nil {
+				return 0, err
+			}
+			return n, nil
+		}
+		if _, err := t.w.Write(p[:i+1]); err != nil {
+			return 0, err
+		}
+		p = p[i+1:]
+		t.inLine = false
+		if t.timestamp.After(t.cursor.last) {
+			t.cursor.last = t.timestamp
+		}
+	}
+	return n, nil
+}
+
+// logFanout writes to each of its writers independently, so that a failing
+// log driver doesn't stop the others. Failed writers are dropped.
+type logFanout struct {
+	containerID string
+	writers     []io.Writer
+}
+
+// newLogFanout creates the fanout of a stream of the container to the log
+// drivers. Lines written to files are tagged with the stream.
+func newLogFanout(containerID, stream string, writers []*logDriverWriter) *logFanout {
+	f := &logFanout{containerID: containerID}
+	for _, w := range writers {
+		if w.driver == logDriverFile {
+			f.writers = append(f.writers, newCRILogWriter(w, stream))
+			continue
+		}
+		f.writers = append(f.writers, w)
+	}
+	return f
+}
+
+// flush flushes the incomplete lines of CRI log files.
+func (f *logFanout) flush() {
+	for _, w := range f.writers {
+		if c, ok := w.(*criLogWriter); ok {
+			c.flush()
+		}
+	}
+}
+
+// Write implements io.Writer. It only fails once all writers failed.
+func (f *logFanout) Write(p []byte) (int, error) {
+	var lastErr error
+	writers := f.writers[:0]
+	for _, w := range f.writers {
+		if _, err := w.Write(p); err != nil {
+			glog.Errorf("Write logs of container %q failed, dropping the log driver: %v", f.containerID, err)
+			lastErr = err
+			continue
+		}
+		writers = append(writers, w)
+	}
+	f.writers = writers
+
+	if len(f.writers) == 0 {
+		return 0, lastErr
+	}
+	return len(p), nil
+}
+
+// startLogCopier follows the logs of the container in background and copies
+// them to logPath at most h.config.LogRateLimit bytes per second. Once the
+// limit is reached, hyperd is pushed back through gRPC flow control instead
+// of buffering logs in frakti. Logs are sent to all log drivers of the container,
+// which are validated by CreateContainer.
+//
+// All log streams share the single HTTP/2 connection to hyperd, which
+// multiplexes them as tagged frames already. How container output is carried
+// from the VM (serial port or vsock channels) is decided by hyperd and
+// hyperstart, so sharing guest channels between containers of large pods
+// needs to be done there rather than in frakti.
+func (h *Runtime) startLogCopier(containerID string, config *kubeapi.ContainerConfig, sandboxConfig *kubeapi.PodSandboxConfig) {
+	go func() {
+		writers, err := h.newLogWriters(containerID, config, sandboxConfig)
+		if err != nil {
+			glog.Errorf("Create log writers of container %q failed: %v", containerID, err)
+			return
+		}
+		if len(writers) == 0 {
+			return
+		}
+
+		for _, w := range writers {
+			defer w.Close()
+		}
+
+		stdout := newLogFanout(containerID, logStreamStdout, writers)
+		defer stdout.flush()
+		stderr := newLogFanout(containerID, logStreamStderr, writers)
+		defer stderr.flush()
+
+		// Retries resume after the last complete line, with writers built
+		// again so that nothing is left from the broken stream.
+		cursor := &logCursor{}
+		for retries := 0; ; retries++ {
+			// TTY merges stdout and stderr, otherwise they are multiplexed
+			// by hyperd.
+			var out io.Writer = newLogTimestampWriter(stdout, cursor)
+			if !config.GetTty() {
+				out = newStdDemuxWriter(out, newLogTimestampWriter(stderr, cursor))
+			}
+			out = newRateLimitedWriter(out, h.config.LogRateLimit)
+
+			err := h.client.ContainerLogs(containerID, true, cursor.since(), out)
+			if err == nil {
+				glog.V(3).Infof("Log stream of container %q finished", containerID)
+				return
+			}
+			if retries >= logMaxRetries {
+				glog.Errorf("Follow logs of container %q failed: %v", containerID, err)
+				return
+			}
+
+			glog.Warningf("Follow logs of container %q failed: %v, retrying", containerID, err)
+			time.Sleep(logRetryInterval)
+		}
+	}()
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/frakti/pkg/metrics"
+)
+
+const (
+	// sandboxMonitorInterval is the interval of checking sandbox VMs.
+	sandboxMonitorInterval = 5 * time.Second
+	// crashReasonLabel records why a sandbox crashed on its hyper pod, which
+	// is reported to kubelet with the sandbox labels.
+	crashReasonLabel = annotationPrefix + "crash-reason"
+)
+
+// sandboxMonitor detects sandboxes whose VMs exited unexpectedly, i.e.
+// sandboxes once running but no longer running without being stopped.
+type sandboxMonitor struct {
+	sync.Mutex
+	// running are the sandboxes seen running.
+	running map[string]bool
+	// stopping are the sandboxes being stopped or removed by kubelet.
+	stopping map[string]bool
+}
+
+func newSandboxMonitor() *sandboxMonitor {
+	return &sandboxMonitor{
+		running:  make(map[string]bool),
+		stopping: make(map[string]bool),
+	}
+}
+
+// expectStop marks the sandbox as being stopped, so it isn't reported as
+// crashed when its VM exits.
+func (m *sandboxMonitor) expectStop(podID string) {
+	m.Lock()
+	defer m.Unlock()
+	m.stopping[podID] = true
+}
+
+// update updates the running sandboxes with the latest pod phases, and
+// returns the crashed ones.
+func (m *sandboxMonitor) update(phases map[string]string) []string {
+	m.Lock()
+	defer m.Unlock()
+
+	var crashed []string
+	for podID := range m.running {
+		if phases[podID] == hyperPodPhaseRunning {
+			continue
+		}
+		if !m.stopping[podID] {
+			crashed = append(crashed, podID)
+		}
+		delete(m.running, podID)
+	}
+	for podID, phase := range phases {
+		if phase == hyperPodPhaseRunning && !m.stopping[podID] {
+			m.running[podID] = true
+		}
+	}
+	for podID := range m.stopping {
+		if _, ok := phases[podID]; !ok {
+			delete(m.stopping, podID)
+		}
+	}
+
+	return crashed
+}
+
+// monitorSandboxes periodically checks sandbox VMs. Crashed sandboxes are
+// stopped and their network is cleaned up to release their resources, so
+// kubelet sees them not ready and recreates them promptly.
+//
+// TODO: also probe the guest agent (hyperstart) of running sandboxes, and
+// restart it over the hypervisor channel when it stops responding. hyperd
+// neither exposes an agent ping nor a way to restart the agent, and a hung
+// agent isn't reflected in the pod phase.
+func (h *Runtime) monitorSandboxes() {
+	for range time.Tick(sandboxMonitorInterval) {
+		pods, err := h.client.ListPods()
+		if err != nil {
+			glog.Warningf("List pods for monitoring sandboxes failed: %v", err)
+			continue
+		}
+
+		phases := make(map[string]string, len(pods))
+		labels := make(map[string]map[string]string, len(pods))
+		for _, pod := range pods {
+			phases[pod.PodID] = pod.Status
+			labels[pod.PodID] = pod.Labels
+		}
+
+		for _, podID := range h.monitor.update(phases) {
+			glog.Errorf("%s: sandbox %q exited unexpectedly with phase %q", reasonVMExited, podID, phases[podID])
+			metrics.SandboxCrashes.Inc(labels[podID][kubernetesPodNamespaceLabel])
+
+			if _, ok := phases[podID]; !ok {
+				continue
+			}
+			h.cleanupCrashedSandbox(podID)
+		}
+	}
+}
+
+// cleanupCrashedSandbox stops a crashed sandbox, cleans up its network like
+// removeSandbox does and releases its static addresses, so that a recreated
+// sandbox could take them. The crash reason is recorded as a label.
+func (h *Runtime) cleanupCrashedSandbox(podID string) {
+	info, err := h.client.GetPodInfo(podID)
+
+	h.monitor.expectStop(podID)
+	if err := h.client.StopPod(podID); err != nil {
+		glog.Warningf("Stop crashed sandbox %q failed: %v", podID, err)
+	}
+
+	h.cleanupSandboxNetwork(podID, info, err)
+	if err == nil {
+		h.staticAddresses.release(info.PodName)
+	}
+
+	if err := h.client.SetPodLabels(podID, map[string]string{crashReasonLabel: reasonVMExited}, false); err != nil {
+		glog.Warningf("Record crash reason of sandbox %q failed: %v", podID, err)
+	}
+}
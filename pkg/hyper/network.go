@@ -0,0 +1,254 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/hyperhq/hyperd/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+const (
+	// netDatapathVirtio is the virtio-net datapath backed by host tap devices.
+	netDatapathVirtio = "virtio"
+	// podInterfaceName is the name of the pod NIC inside the VM.
+	podInterfaceName = "eth0"
+
+	// minMTU and maxMTU are the bounds of MTU accepted for pod NICs.
+	minMTU = 68
+	maxMTU = 65535
+)
+
+// validateNetworkOptions checks the network options requested by sandbox
+// annotations are supported.
+//
+// TODO: support multi-queue virtio-net and vhost-user (OVS-DPDK) datapaths
+// once hyperd's UserInterface could carry them. Until then, pods requesting
+// them are rejected instead of silently getting a single queue virtio-net NIC.
+func validateNetworkOptions(config *kubeapi.PodSandboxConfig) error {
+	annotations := config.GetAnnotations()
+	if datapath, ok := annotations[netDatapathAnnotation]; ok && datapath != netDatapathVirtio {
+		return fmt.Errorf("network datapath %q is not supported, only %q is available", datapath, netDatapathVirtio)
+	}
+
+	if v, ok := annotations[netQueuesAnnotation]; ok {
+		queues, err := strconv.Atoi(v)
+		if err != nil || queues < 1 {
+			return fmt.Errorf("invalid network queues %q", v)
+		}
+		if queues > 1 {
+			return fmt.Errorf("multi-queue virtio-net is not supported, requested %d queues", queues)
+		}
+	}
+
+	return validateNetworkTuning(annotations)
+}
+
+// validateNetworkTuning checks the MTU, TX queue length and offload tuning
+// requested by sandbox annotations.
+//
+// TODO: apply the tuning to both the host tap device and the guest NIC. Both
+// are set up by hyperd, and neither its UserInterface nor hyperstart could
+// carry them yet, so any tuning is rejected instead of being applied to only
+// one side of the link.
+func validateNetworkTuning(annotations map[string]string) error {
+	if v, ok := annotations[netMTUAnnotation]; ok {
+		mtu, err := strconv.Atoi(v)
+		if err != nil || mtu < minMTU || mtu > maxMTU {
+			return fmt.Errorf("invalid network MTU %q, must be in range [%d, %d]", v, minMTU, maxMTU)
+		}
+		return fmt.Errorf("network MTU tuning is not supported, requested %d", mtu)
+	}
+
+	if v, ok := annotations[netTxQueueLenAnnotation]; ok {
+		qlen, err := strconv.Atoi(v)
+		if err != nil || qlen < 0 {
+			return fmt.Errorf("invalid network TX queue length %q", v)
+		}
+		return fmt.Errorf("network TX queue length tuning is not supported, requested %d", qlen)
+	}
+
+	if v, ok := annotations[netOffloadsAnnotation]; ok {
+		return fmt.Errorf("network offload tuning is not supported, requested %q", v)
+	}
+
+	return nil
+}
+
+// validateNamespaceOptions checks the namespace options of the sandbox. All
+// containers of a sandbox always share the pod network of its VM, so the
+// "pod" mode is the only one supported. The "node" mode (host network), as
+// well as host pid and ipc namespaces, can't be provided by a VM and are
+// rejected instead of being silently ignored.
+//
+// TODO: support a shared pid namespace among containers of a sandbox once
+// the runtime API has the option and hyperstart could enforce it.
+func validateNamespaceOptions(config *kubeapi.PodSandboxConfig) error {
+	options := config.GetLinux().GetNamespaceOptions()
+	if options == nil {
+		return nil
+	}
+
+	if options.GetHostNetwork() {
+		return grpc.Errorf(codes.InvalidArgument, "host network is not supported by hypervisor-based sandboxes")
+	}
+	if options.GetHostPid() {
+		return grpc.Errorf(codes.InvalidArgument, "host pid namespace is not supported by hypervisor-based sandboxes")
+	}
+	if options.GetHostIpc() {
+		return grpc.Errorf(codes.InvalidArgument, "host ipc namespace is not supported by hypervisor-based sandboxes")
+	}
+
+	return nil
+}
+
+const (
+	// staticIPLabel and staticMACLabel record the static addresses of hyper
+	// pods, so that reservations are restored after frakti restarts.
+	staticIPLabel  = staticIPAnnotation
+	staticMACLabel = staticMACAnnotation
+)
+
+// staticAddresses tracks the static IP and MAC addresses requested by
+// sandboxes through annotations, to detect conflicts between sandboxes.
+type staticAddresses struct {
+	sync.Mutex
+	// ips and macs map addresses to the names of hyper pods owning them,
+	// i.e. UserPod.Id when created and PodName when listed or inspected.
+	ips  map[string]string
+	macs map[string]string
+}
+
+func newStaticAddresses() *staticAddresses {
+	return &staticAddresses{
+		ips:  make(map[string]string),
+		macs: make(map[string]string),
+	}
+}
+
+// reserve validates and reserves the static addresses requested by the
+// sandbox for the hyper pod name, and returns the pod interface with them.
+// nil is returned if the sandbox doesn't request static addresses.
+func (s *staticAddresses) reserve(name string, config *kubeapi.PodSandboxConfig) (*types.UserInterface, error) {
+	annotations := config.GetAnnotations()
+	ipAddress, mac, gateway := annotations[staticIPAnnotation], annotations[staticMACAnnotation], annotations[staticGatewayAnnotation]
+	if ipAddress == "" && mac == "" {
+		return nil, nil
+	}
+
+	var ip net.IP
+	if ipAddress != "" {
+		var err error
+		if ip, _, err = net.ParseCIDR(ipAddress); err != nil {
+			return nil, grpc.Errorf(codes.InvalidArgument, "invalid static IP %q, CIDR is required", ipAddress)
+		}
+	}
+	if mac != "" {
+		hw, err := net.ParseMAC(mac)
+		if err != nil {
+			return nil, grpc.Errorf(codes.InvalidArgument, "invalid static MAC %q", mac)
+		}
+		mac = hw.String()
+	}
+	if gateway != "" && net.ParseIP(gateway) == nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "invalid gateway %q", gateway)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if owner, ok := s.ips[ip.String()]; ip != nil && ok && owner != name {
+		return nil, grpc.Errorf(codes.AlreadyExists, "static IP %s is used by sandbox %q", ip, owner)
+	}
+	if owner, ok := s.macs[mac]; mac != "" && ok && owner != name {
+		return nil, grpc.Errorf(codes.AlreadyExists, "static MAC %s is used by sandbox %q", mac, owner)
+	}
+
+	if ip != nil {
+		s.ips[ip.String()] = name
+	}
+	if mac != "" {
+		s.macs[mac] = name
+	}
+
+	return &types.UserInterface{
+		Ifname:  podInterfaceName,
+		Ip:      ipAddress,
+		Mac:     mac,
+		Gateway: gateway,
+	}, nil
+}
+
+// restore reserves the addresses recorded in the labels of existing hyper
+// pods. Crashed pods released their addresses already.
+func (s *staticAddresses) restore(pods []*types.PodListResult) {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, pod := range pods {
+		if pod.Labels[crashReasonLabel] != "" {
+			continue
+		}
+		if ip := pod.Labels[staticIPLabel]; ip != "" {
+			if parsed, _, err := net.ParseCIDR(ip); err == nil {
+				s.ips[parsed.String()] = pod.PodName
+			}
+		}
+		if mac := pod.Labels[staticMACLabel]; mac != "" {
+			s.macs[mac] = pod.PodName
+		}
+	}
+}
+
+// addStaticAddressLabels records the static addresses of the interface in
+// the labels of the hyper pod.
+func addStaticAddressLabels(userpod *types.UserPod, iface *types.UserInterface) {
+	labels := make(map[string]string, len(userpod.Labels)+2)
+	for k, v := range userpod.Labels {
+		labels[k] = v
+	}
+	if iface.Ip != "" {
+		labels[staticIPLabel] = iface.Ip
+	}
+	if iface.Mac != "" {
+		labels[staticMACLabel] = iface.Mac
+	}
+	userpod.Labels = labels
+}
+
+// release releases the static addresses of the hyper pod.
+func (s *staticAddresses) release(name string) {
+	s.Lock()
+	defer s.Unlock()
+
+	for ip, owner := range s.ips {
+		if owner == name {
+			delete(s.ips, ip)
+		}
+	}
+	for mac, owner := range s.macs {
+		if owner == name {
+			delete(s.macs, mac)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// nodeLabelPrefix is the common prefix of node labels written by frakti.
+	nodeLabelPrefix = "frakti.kubernetes.io/"
+
+	kvmDevice = "/dev/kvm"
+)
+
+// nestedVirtParameters are the kvm module parameters enabling nested
+// virtualization on Intel and AMD hosts.
+var nestedVirtParameters = []string{
+	"/sys/module/kvm_intel/parameters/nested",
+	"/sys/module/kvm_amd/parameters/nested",
+}
+
+// kvmAvailable returns whether the host supports KVM acceleration.
+func kvmAvailable() bool {
+	_, err := os.Stat(kvmDevice)
+	return err == nil
+}
+
+// nestedVirtEnabled returns whether the host allows running hypervisors in
+// its guests.
+func nestedVirtEnabled() bool {
+	for _, path := range nestedVirtParameters {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		v := strings.TrimSpace(string(data))
+		if v == "Y" || v == "1" {
+			return true
+		}
+	}
+	return false
+}
+
+// NodeLabels returns the node labels describing the capabilities of this
+// node, so that schedulers could target frakti nodes.
+func (h *Runtime) NodeLabels() (map[string]string, error) {
+	info, err := h.client.GetInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{
+		nodeLabelPrefix + "hypervisor":  info.ExecutionDriver,
+		nodeLabelPrefix + "kvm":         strconv.FormatBool(kvmAvailable()),
+		nodeLabelPrefix + "nested-virt": strconv.FormatBool(nestedVirtEnabled()),
+		// hyperd shares volumes with VMs by 9p or block devices only.
+		nodeLabelPrefix + "virtio-fs": "false",
+	}, nil
+}
+
+// WriteNodeLabels writes the node labels to path in kubelet's node-labels
+// flag format, so that kubelet config tooling could consume them.
+func (h *Runtime) WriteNodeLabels(path string) error {
+	labels, err := h.NodeLabels()
+	if err != nil {
+		return err
+	}
+
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	content := fmt.Sprintf("--node-labels=%s\n", strings.Join(pairs, ","))
+
+	glog.V(3).Infof("Writing node labels to %s: %q", path, content)
+	return ioutil.WriteFile(path, []byte(content), reservedFilePermissions)
+}
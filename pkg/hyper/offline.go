@@ -0,0 +1,111 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/hyperhq/hyperd/types"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+const (
+	// offlinePullInterval is the interval of pulling images again which
+	// failed in offline mode.
+	offlinePullInterval = time.Minute
+)
+
+type offlinePull struct {
+	image      *kubeapi.ImageSpec
+	authConfig *kubeapi.AuthConfig
+}
+
+// offlinePulls are the images used locally because they failed to be pulled
+// in offline mode, keyed by image name.
+type offlinePulls struct {
+	sync.Mutex
+	pulls map[string]*offlinePull
+}
+
+func newOfflinePulls() *offlinePulls {
+	return &offlinePulls{pulls: make(map[string]*offlinePull)}
+}
+
+func (p *offlinePulls) add(image *kubeapi.ImageSpec, authConfig *kubeapi.AuthConfig) {
+	p.Lock()
+	defer p.Unlock()
+	p.pulls[image.GetImage()] = &offlinePull{image: image, authConfig: authConfig}
+}
+
+func (p *offlinePulls) remove(image string) {
+	p.Lock()
+	defer p.Unlock()
+	delete(p.pulls, image)
+}
+
+func (p *offlinePulls) list() []*offlinePull {
+	p.Lock()
+	defer p.Unlock()
+
+	pulls := make([]*offlinePull, 0, len(p.pulls))
+	for _, pull := range p.pulls {
+		pulls = append(pulls, pull)
+	}
+	return pulls
+}
+
+// ImageExists returns whether the image exists locally.
+func (h *Runtime) ImageExists(image string) (bool, error) {
+	info, err := h.findImage(image)
+	return info != nil, err
+}
+
+// findImage returns the local image, or nil if it doesn't exist.
+func (h *Runtime) findImage(image string) (*types.ImageInfo, error) {
+	images, err := h.client.ListImages(false)
+	if err != nil {
+		return nil, err
+	}
+
+	repo, tag := parseImageName(image)
+	for _, info := range images {
+		for _, ref := range append(info.RepoTags, info.RepoDigests...) {
+			if ref == image || ref == repo+":"+tag || ref == repo+"@"+tag {
+				return info, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// retryOfflinePulls periodically pulls the images used locally in offline
+// mode again, so they are re-validated once the registry is reachable.
+func (h *Runtime) retryOfflinePulls() {
+	for range time.Tick(offlinePullInterval) {
+		for _, pull := range h.offlinePulls.list() {
+			if err := h.pullImage(pull.image, pull.authConfig); err != nil {
+				glog.V(4).Infof("Pull image %q in offline mode failed again: %v", pull.image.GetImage(), err)
+				continue
+			}
+
+			glog.V(3).Infof("Pulled image %q used locally in offline mode", pull.image.GetImage())
+			h.offlinePulls.remove(pull.image.GetImage())
+		}
+	}
+}
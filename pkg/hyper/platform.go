@@ -0,0 +1,235 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	goruntime "runtime"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+const (
+	mediaTypeManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeOCIIndex     = "application/vnd.oci.image.index.v1+json"
+	mediaTypeOCIManifest  = "application/vnd.oci.image.manifest.v1+json"
+	// maxImagePlatforms is the max number of entries cached by imagePlatforms.
+	maxImagePlatforms = 1024
+	// guestOS is the only OS sandbox VMs could run.
+	guestOS = "linux"
+)
+
+// supportedPlatform returns the image platform supported by this node.
+func supportedPlatform() string {
+	return guestOS + "/" + goruntime.GOARCH
+}
+
+// UnsupportedPlatformError is returned when an image is built for platforms
+// which sandbox VMs can't run, e.g. windows/amd64.
+type UnsupportedPlatformError struct {
+	Image     string
+	Platforms []string
+}
+
+// Error implements the error interface.
+func (e *UnsupportedPlatformError) Error() string {
+	return fmt.Sprintf("image %q is built for %s, but only %s is supported",
+		e.Image, strings.Join(e.Platforms, ","), supportedPlatform())
+}
+
+// registryGet gets path from the registry with the bearer token.
+func (c *authCache) registryGet(registry, path, token string, accept ...string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", c.registryURL(registry, path), nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, mediaType := range accept {
+		req.Header.Add("Accept", mediaType)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("get %s from %s failed: %s", path, registry, resp.Status)
+	}
+
+	return resp, nil
+}
+
+// isDigest returns whether the tag of an image is a digest, e.g. sha256:...
+func isDigest(tag string) bool {
+	return strings.Contains(tag, ":")
+}
+
+// imagePlatforms gets the platforms ("os/arch") of the image from its registry.
+// The platforms of image configs, which are content addressed, are looked up
+// in and added to known, saving the request of the config blob.
+func (c *authCache) imagePlatforms(repo, tag string, auth *kubeapi.AuthConfig, known *imagePlatforms) ([]string, error) {
+	registry, remote := splitRepository(repo)
+	token, err := c.token(repo, auth)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.registryGet(registry, fmt.Sprintf("/v2/%s/manifests/%s", remote, tag), token,
+		mediaTypeManifestList, mediaTypeOCIIndex, mediaTypeManifest, mediaTypeOCIManifest)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var manifest struct {
+		Manifests []struct {
+			Platform struct {
+				OS           string `json:"os"`
+				Architecture string `json:"architecture"`
+			} `json:"platform"`
+		} `json:"manifests"`
+		Config struct {
+			Digest string `json:"digest"`
+		} `json:"config"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
+		return nil, err
+	}
+
+	mediaType := strings.TrimSpace(strings.SplitN(resp.Header.Get("Content-Type"), ";", 2)[0])
+	if mediaType == mediaTypeManifestList || mediaType == mediaTypeOCIIndex {
+		var platforms []string
+		for _, m := range manifest.Manifests {
+			platforms = append(platforms, m.Platform.OS+"/"+m.Platform.Architecture)
+		}
+		return platforms, nil
+	}
+
+	if manifest.Config.Digest == "" {
+		return nil, fmt.Errorf("unknown manifest type %q", mediaType)
+	}
+	if platforms := known.get(manifest.Config.Digest); platforms != nil {
+		return platforms, nil
+	}
+	configResp, err := c.registryGet(registry, fmt.Sprintf("/v2/%s/blobs/%s", remote, manifest.Config.Digest), token)
+	if err != nil {
+		return nil, err
+	}
+	defer configResp.Body.Close()
+
+	var imageConfig struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+	}
+	if err := json.NewDecoder(configResp.Body).Decode(&imageConfig); err != nil {
+		return nil, err
+	}
+
+	platforms := []string{imageConfig.OS + "/" + imageConfig.Architecture}
+	known.set(manifest.Config.Digest, platforms)
+	return platforms, nil
+}
+
+// imagePlatforms caches the platforms of images checked at pull time, so
+// that containers of unsupported images existing locally are rejected at
+// creation without querying registries again. It caches the platforms of
+// image configs by digest as well. The oldest entries are evicted once
+// there are more than maxImagePlatforms.
+type imagePlatforms struct {
+	sync.Mutex
+	platforms map[string][]string
+	// order is the keys of platforms from the oldest to the newest.
+	order []string
+}
+
+func newImagePlatforms() *imagePlatforms {
+	return &imagePlatforms{platforms: make(map[string][]string)}
+}
+
+func (p *imagePlatforms) set(image string, platforms []string) {
+	p.Lock()
+	defer p.Unlock()
+	if _, ok := p.platforms[image]; !ok {
+		p.order = append(p.order, image)
+	}
+	p.platforms[image] = platforms
+	for len(p.order) > maxImagePlatforms {
+		delete(p.platforms, p.order[0])
+		p.order = p.order[1:]
+	}
+}
+
+func (p *imagePlatforms) get(image string) []string {
+	p.Lock()
+	defer p.Unlock()
+	return p.platforms[image]
+}
+
+// checkPlatforms returns UnsupportedPlatformError if none of platforms is the
+// supported one. Unknown platforms are allowed.
+func checkPlatforms(image string, platforms []string) error {
+	if len(platforms) == 0 {
+		return nil
+	}
+	for _, platform := range platforms {
+		if platform == supportedPlatform() {
+			return nil
+		}
+	}
+
+	return &UnsupportedPlatformError{Image: image, Platforms: platforms}
+}
+
+// checkImagePlatform returns UnsupportedPlatformError if the image isn't built
+// for the supported platform. Insecure and mirrored registries aren't queried,
+// nor are registries for images pulled by digest and checked before. Images
+// whose platforms can't be determined are allowed.
+func (h *Runtime) checkImagePlatform(image, repo, tag string, auth *kubeapi.AuthConfig) error {
+	registry, _ := splitRepository(repo)
+	if h.config.isInsecureRegistry(registry) || h.config.isMirroredRegistry(registry) {
+		return nil
+	}
+	if isDigest(tag) {
+		if platforms := h.imagePlatforms.get(image); platforms != nil {
+			return checkPlatforms(image, platforms)
+		}
+	}
+
+	platforms, err := h.authCache.imagePlatforms(repo, tag, auth, h.imagePlatforms)
+	if err != nil {
+		glog.Warningf("Get platforms of image %q failed, skipping the platform check: %v", image, err)
+		return nil
+	}
+	h.imagePlatforms.set(image, platforms)
+
+	return checkPlatforms(image, platforms)
+}
+
+// checkContainerImagePlatform returns UnsupportedPlatformError if the image
+// of a container is known to be built for unsupported platforms.
+func (h *Runtime) checkContainerImagePlatform(image string) error {
+	return checkPlatforms(image, h.imagePlatforms.get(image))
+}
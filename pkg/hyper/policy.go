@@ -0,0 +1,155 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+const (
+	// kubernetesPodNamespaceLabel is the label of pod namespace set by kubelet.
+	kubernetesPodNamespaceLabel = "io.kubernetes.pod.namespace"
+	// kubernetesPodNameLabel is the label of pod name set by kubelet.
+	kubernetesPodNameLabel = "io.kubernetes.pod.name"
+	// defaultNamespacePolicy is the policy of namespaces without their own.
+	defaultNamespacePolicy = "*"
+)
+
+// NamespacePolicy constrains the sandboxes and containers of a namespace.
+// Empty fields mean unconstrained.
+type NamespacePolicy struct {
+	// AllowedRuntimeHandlers are the runtime handlers (i.e. hypervisor
+	// configurations) sandboxes could select.
+	AllowedRuntimeHandlers []string `json:"allowedRuntimeHandlers"`
+	// MaxCPU and MaxMemoryMB limit the VM size of sandboxes.
+	MaxCPU      int32 `json:"maxCPU"`
+	MaxMemoryMB int32 `json:"maxMemoryMB"`
+	// AllowedAnnotations are the frakti annotations sandboxes and containers
+	// could set.
+	AllowedAnnotations []string `json:"allowedAnnotations"`
+	// AllowedRegistries are the registries images could be pulled from.
+	AllowedRegistries []string `json:"allowedRegistries"`
+	// MaxSandboxes and MaxTotalMemoryMB limit the number and the total VM
+	// memory of sandboxes of the namespace on the node, 0 means unlimited.
+	MaxSandboxes     int   `json:"maxSandboxes"`
+	MaxTotalMemoryMB int64 `json:"maxTotalMemoryMB"`
+}
+
+// LoadNamespacePolicies loads namespace policies from a JSON file mapping
+// namespaces to their policies, "*" for other namespaces.
+func LoadNamespacePolicies(path string) (map[string]*NamespacePolicy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	policies := make(map[string]*NamespacePolicy)
+	if err := json.Unmarshal(data, &policies); err != nil {
+		return nil, fmt.Errorf("parse namespace policies %s failed: %v", path, err)
+	}
+	for ns, policy := range policies {
+		if policy == nil || policy.MaxCPU < 0 || policy.MaxMemoryMB < 0 {
+			return nil, fmt.Errorf("invalid policy of namespace %q", ns)
+		}
+	}
+
+	return policies, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// sandboxNamespace returns the kubernetes namespace of the sandbox.
+func sandboxNamespace(config *kubeapi.PodSandboxConfig) string {
+	return config.GetLabels()[kubernetesPodNamespaceLabel]
+}
+
+// namespacePolicy returns the policy of the sandbox's namespace, or nil if
+// there isn't any.
+func (h *Runtime) namespacePolicy(config *kubeapi.PodSandboxConfig) (string, *NamespacePolicy) {
+	namespace := sandboxNamespace(config)
+	if policy, ok := h.config.NamespacePolicies[namespace]; ok {
+		return namespace, policy
+	}
+
+	return namespace, h.config.NamespacePolicies[defaultNamespacePolicy]
+}
+
+// checkAnnotations checks frakti annotations are allowed by the policy.
+func (p *NamespacePolicy) checkAnnotations(namespace string, annotations map[string]string) error {
+	if p.AllowedAnnotations == nil {
+		return nil
+	}
+
+	for key := range annotations {
+		if strings.HasPrefix(key, annotationPrefix) && !contains(p.AllowedAnnotations, key) {
+			return grpc.Errorf(codes.PermissionDenied, "annotation %q is not allowed in namespace %q", key, namespace)
+		}
+	}
+	return nil
+}
+
+// enforceSandboxPolicy enforces the namespace policy on sandbox creation.
+func (h *Runtime) enforceSandboxPolicy(config *kubeapi.PodSandboxConfig, handlerName string, vcpu, memoryMB int32) error {
+	namespace, policy := h.namespacePolicy(config)
+	if policy == nil {
+		return nil
+	}
+
+	if policy.AllowedRuntimeHandlers != nil && !contains(policy.AllowedRuntimeHandlers, handlerName) {
+		return grpc.Errorf(codes.PermissionDenied, "runtime handler %q is not allowed in namespace %q", handlerName, namespace)
+	}
+	if policy.MaxCPU > 0 && vcpu > policy.MaxCPU {
+		return grpc.Errorf(codes.PermissionDenied, "%d vcpus exceeds the max %d of namespace %q", vcpu, policy.MaxCPU, namespace)
+	}
+	if policy.MaxMemoryMB > 0 && memoryMB > policy.MaxMemoryMB {
+		return grpc.Errorf(codes.PermissionDenied, "%dMB memory exceeds the max %dMB of namespace %q", memoryMB, policy.MaxMemoryMB, namespace)
+	}
+
+	return policy.checkAnnotations(namespace, config.GetAnnotations())
+}
+
+// enforceContainerPolicy enforces the namespace policy on container creation.
+func (h *Runtime) enforceContainerPolicy(config *kubeapi.ContainerConfig, sandboxConfig *kubeapi.PodSandboxConfig) error {
+	namespace, policy := h.namespacePolicy(sandboxConfig)
+	if policy == nil {
+		return nil
+	}
+
+	if policy.AllowedRegistries != nil {
+		repo, _ := parseImageName(config.GetImage().GetImage())
+		registry, _ := splitRepository(repo)
+		if !contains(policy.AllowedRegistries, registry) {
+			return grpc.Errorf(codes.PermissionDenied, "registry %q is not allowed in namespace %q", registry, namespace)
+		}
+	}
+
+	return policy.checkAnnotations(namespace, config.GetAnnotations())
+}
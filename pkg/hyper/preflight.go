@@ -0,0 +1,116 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	goruntime "runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	memInfoPath = "/proc/meminfo"
+	// hyperRootDir is where hyperd keeps images and VM disks.
+	hyperRootDir = "/var/lib/hyper"
+	// defaultPreflightMarginMB is the free host memory and disk kept on top
+	// of sandbox VMs by default.
+	defaultPreflightMarginMB = 256
+)
+
+// availableMemoryMB returns the host memory available for new VMs.
+func availableMemoryMB() (int64, error) {
+	f, err := os.Open(memInfoPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemAvailable:" {
+			continue
+		}
+		kb, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return kb / 1024, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("MemAvailable not found in %s", memInfoPath)
+}
+
+// availableDiskMB returns the free disk space of path.
+func availableDiskMB(path string) (int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize) / megabyte, nil
+}
+
+// preflightSandbox checks the host has enough CPUs, memory and disk for a
+// sandbox VM with vcpu and memoryMB, plus the configured margin, so that the
+// creation fails fast instead of the hypervisor being OOM killed while
+// booting. Resources which can't be read aren't checked. VMs are backed by
+// normal pages, so hugepages aren't checked.
+//
+// The memory of sandboxes passing the check is reserved until their VMs
+// have booted and show up in the host's available memory, so that
+// concurrent creations don't all pass against the same free memory. The
+// returned release should be called once the sandbox has started or failed.
+func (h *Runtime) preflightSandbox(vcpu, memoryMB int32) (func(), error) {
+	if cpus := goruntime.NumCPU(); int(vcpu) > cpus {
+		return nil, grpc.Errorf(codes.ResourceExhausted, "sandbox requires %d vcpus, but the node has only %d cpus", vcpu, cpus)
+	}
+
+	margin := h.config.PreflightMarginMB
+	if available, err := availableDiskMB(hyperRootDir); err == nil && available < margin {
+		return nil, grpc.Errorf(codes.ResourceExhausted,
+			"sandbox requires %dMB free disk in %s, but only %dMB is available", margin, hyperRootDir, available)
+	}
+
+	required := int64(memoryMB) + vmMemoryOverheadMB
+	h.preflightLock.Lock()
+	defer h.preflightLock.Unlock()
+
+	if available, err := availableMemoryMB(); err == nil {
+		available -= h.preflightMemoryMB
+		if available < required+margin {
+			return nil, grpc.Errorf(codes.ResourceExhausted,
+				"sandbox requires %dMB memory (including %dMB overhead and %dMB margin), but only %dMB is available (%dMB reserved by sandboxes being created)",
+				required+margin, vmMemoryOverheadMB, margin, available, h.preflightMemoryMB)
+		}
+	}
+
+	h.preflightMemoryMB += required
+	return func() {
+		h.preflightLock.Lock()
+		defer h.preflightLock.Unlock()
+		h.preflightMemoryMB -= required
+	}, nil
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+// deletionProtectionLabel marks hyper pods protected from deletion. Sandbox
+// annotations aren't kept by hyperd, so the protection is recorded as a label.
+const deletionProtectionLabel = deletionProtectionAnnotation
+
+// sandboxLabels returns the labels of the hyper pod of a sandbox.
+func sandboxLabels(config *kubeapi.PodSandboxConfig) map[string]string {
+	if config.GetAnnotations()[deletionProtectionAnnotation] != "true" {
+		return config.GetLabels()
+	}
+
+	labels := make(map[string]string, len(config.GetLabels())+1)
+	for k, v := range config.GetLabels() {
+		labels[k] = v
+	}
+	labels[deletionProtectionLabel] = "true"
+	return labels
+}
+
+// checkDeletionProtection returns a FailedPrecondition error if the sandbox
+// is protected from deletion. Sandboxes which can't be inspected are not
+// protected, so that their deletion isn't blocked by hyperd errors.
+func (h *Runtime) checkDeletionProtection(podSandBoxID string) error {
+	info, err := h.client.GetPodInfo(podSandBoxID)
+	if err != nil || info.Spec == nil {
+		return nil
+	}
+
+	if info.Spec.Labels[deletionProtectionLabel] == "true" {
+		return grpc.Errorf(codes.FailedPrecondition,
+			"sandbox %q is protected from deletion by annotation %s, force delete it via the admin API",
+			podSandBoxID, deletionProtectionAnnotation)
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+// QoS classes of kubernetes pods.
+const (
+	qosGuaranteed = "Guaranteed"
+	qosBurstable  = "Burstable"
+	qosBestEffort = "BestEffort"
+)
+
+// qosClass returns the QoS class of a sandbox by its resources: Guaranteed
+// if both cpu and memory have limits equal to their requests, BestEffort if
+// neither has any limits or requests, otherwise Burstable.
+func qosClass(config *kubeapi.PodSandboxConfig) string {
+	resources := []*kubeapi.ResourceRequirements{
+		config.GetResources().GetCpu(),
+		config.GetResources().GetMemory(),
+	}
+
+	guaranteed, bestEffort := true, true
+	for _, r := range resources {
+		limits, requests := r.GetLimits(), r.GetRequests()
+		if limits > 0 || requests > 0 {
+			bestEffort = false
+		}
+		if limits <= 0 || (requests > 0 && requests != limits) {
+			guaranteed = false
+		}
+	}
+
+	switch {
+	case guaranteed:
+		return qosGuaranteed
+	case bestEffort:
+		return qosBestEffort
+	default:
+		return qosBurstable
+	}
+}
+
+// LoadQoSProfiles loads the runtime handlers used by sandboxes of each QoS
+// class from a JSON file, e.g. {"Guaranteed": "dedicated"}.
+//
+// TODO: preallocated memory and pinned vCPUs for Guaranteed profiles, and
+// memory ballooning for the others, need hyperd to support these VM options.
+// Until then, profiles differ only in the sizing of their runtime handlers.
+func LoadQoSProfiles(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	profiles := make(map[string]string)
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("parse QoS profiles %s failed: %v", path, err)
+	}
+
+	return profiles, nil
+}
+
+// validateQoSProfiles checks the QoS profiles refer to known QoS classes and
+// configured runtime handlers.
+func validateQoSProfiles(config *Config) error {
+	for class, handler := range config.QoSProfiles {
+		switch class {
+		case qosGuaranteed, qosBurstable, qosBestEffort:
+		default:
+			return fmt.Errorf("invalid QoS class %q", class)
+		}
+		if _, ok := config.RuntimeHandlers[handler]; !ok {
+			return fmt.Errorf("runtime handler %q of QoS class %s is not configured", handler, class)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/golang/glog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+// sandboxUsage is the number and total VM memory of sandboxes.
+type sandboxUsage struct {
+	sandboxes int
+	memoryMB  int64
+}
+
+func (u *sandboxUsage) add(memoryMB int32) {
+	u.sandboxes++
+	u.memoryMB += int64(memoryMB)
+}
+
+// sandboxMemory keeps the VM memory of sandboxes, so that quota checks
+// don't query every sandbox from hyperd.
+type sandboxMemory struct {
+	sync.Mutex
+	memoryMB map[string]int32
+}
+
+func newSandboxMemory() *sandboxMemory {
+	return &sandboxMemory{memoryMB: make(map[string]int32)}
+}
+
+func (m *sandboxMemory) set(podID string, memoryMB int32) {
+	m.Lock()
+	defer m.Unlock()
+	m.memoryMB[podID] = memoryMB
+}
+
+func (m *sandboxMemory) get(podID string) (int32, bool) {
+	m.Lock()
+	defer m.Unlock()
+	memoryMB, ok := m.memoryMB[podID]
+	return memoryMB, ok
+}
+
+// prune forgets sandboxes not in podIDs.
+func (m *sandboxMemory) prune(podIDs map[string]bool) {
+	m.Lock()
+	defer m.Unlock()
+	for podID := range m.memoryMB {
+		if !podIDs[podID] {
+			delete(m.memoryMB, podID)
+		}
+	}
+}
+
+// sandboxUsages returns the usage of running and pending sandboxes, per
+// namespace. Stopped sandboxes not removed by kubelet yet hold no VM, so they
+// aren't counted. The VM memory of sandboxes not created by this frakti,
+// e.g. before a restart, is got from hyperd once. Sandboxes removed
+// meanwhile are skipped.
+func (h *Runtime) sandboxUsages() (map[string]*sandboxUsage, error) {
+	pods, err := h.client.ListPods()
+	if err != nil {
+		return nil, err
+	}
+
+	usages := make(map[string]*sandboxUsage)
+	podIDs := make(map[string]bool, len(pods))
+	for _, pod := range pods {
+		podIDs[pod.PodID] = true
+		if pod.Status != hyperPodPhaseRunning && pod.Status != hyperPodPhasePending {
+			continue
+		}
+		memoryMB, ok := h.sandboxMemory.get(pod.PodID)
+		if !ok {
+			info, err := h.client.GetPodInfo(pod.PodID)
+			if isPodNotFound(err) {
+				glog.V(4).Infof("Sandbox %q was removed while counting quota usage", pod.PodID)
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if spec := info.GetSpec(); spec != nil {
+				memoryMB = spec.Memory
+			}
+			h.sandboxMemory.set(pod.PodID, memoryMB)
+		}
+
+		namespace := pod.Labels[kubernetesPodNamespaceLabel]
+		if usages[namespace] == nil {
+			usages[namespace] = &sandboxUsage{}
+		}
+		usages[namespace].add(memoryMB)
+	}
+	h.sandboxMemory.prune(podIDs)
+
+	return usages, nil
+}
+
+// hasSandboxQuota returns whether the sandbox is limited by the quota of the
+// node or of its namespace.
+func (h *Runtime) hasSandboxQuota(config *kubeapi.PodSandboxConfig) bool {
+	_, policy := h.namespacePolicy(config)
+	return h.hasNodeQuota() || hasNamespaceQuota(policy)
+}
+
+func (h *Runtime) hasNodeQuota() bool {
+	return h.config.MaxSandboxes > 0 || h.config.MaxTotalMemoryMB > 0
+}
+
+func hasNamespaceQuota(policy *NamespacePolicy) bool {
+	return policy != nil && (policy.MaxSandboxes > 0 || policy.MaxTotalMemoryMB > 0)
+}
+
+// enforceSandboxQuota checks creating a sandbox with VM memory memoryMB
+// exceeds neither the quota of the node nor of its namespace. Callers should
+// hold quotaLock until the sandbox is created, so that concurrent creations
+// are counted.
+func (h *Runtime) enforceSandboxQuota(config *kubeapi.PodSandboxConfig, memoryMB int32) error {
+	namespace, policy := h.namespacePolicy(config)
+	namespaceQuota := hasNamespaceQuota(policy)
+	nodeQuota := h.hasNodeQuota()
+	if !namespaceQuota && !nodeQuota {
+		return nil
+	}
+
+	usages, err := h.sandboxUsages()
+	if err != nil {
+		return err
+	}
+
+	if nodeQuota {
+		total := &sandboxUsage{}
+		for _, usage := range usages {
+			total.sandboxes += usage.sandboxes
+			total.memoryMB += usage.memoryMB
+		}
+		if err := checkQuota("node", total, memoryMB, h.config.MaxSandboxes, h.config.MaxTotalMemoryMB); err != nil {
+			return err
+		}
+	}
+
+	if namespaceQuota {
+		usage := usages[namespace]
+		if usage == nil {
+			usage = &sandboxUsage{}
+		}
+		if err := checkQuota(fmt.Sprintf("namespace %q", namespace), usage, memoryMB, policy.MaxSandboxes, policy.MaxTotalMemoryMB); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkQuota checks adding a sandbox with VM memory memoryMB to usage doesn't
+// exceed maxSandboxes and maxMemoryMB, 0 means unlimited.
+func checkQuota(scope string, usage *sandboxUsage, memoryMB int32, maxSandboxes int, maxMemoryMB int64) error {
+	if maxSandboxes > 0 && usage.sandboxes >= maxSandboxes {
+		return grpc.Errorf(codes.ResourceExhausted, "%s already has %d sandboxes, the max is %d",
+			scope, usage.sandboxes, maxSandboxes)
+	}
+	if maxMemoryMB > 0 && usage.memoryMB+int64(memoryMB) > maxMemoryMB {
+		return grpc.Errorf(codes.ResourceExhausted, "%s would use %dMB VM memory, the max is %dMB",
+			scope, usage.memoryMB+int64(memoryMB), maxMemoryMB)
+	}
+
+	return nil
+}
@@ -0,0 +1,195 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"k8s.io/frakti/pkg/metrics"
+)
+
+const (
+	// removalBackoff is the initial backoff of retrying a failed removal,
+	// doubled after each attempt up to removalMaxBackoff.
+	removalBackoff    = time.Second
+	removalMaxBackoff = 5 * time.Minute
+	removalQueueSize  = 1024
+	// removalMaxAttempts is the number of attempts after which a removal is
+	// given up.
+	removalMaxAttempts = 20
+)
+
+// podNotFoundErrors are messages of errors, reported by hyperd as strings,
+// meaning the pod doesn't exist.
+var podNotFoundErrors = []string{
+	"not found",
+	"can not find",
+	"can not get pod info",
+}
+
+// isPodNotFound returns whether err means the hyper pod doesn't exist.
+func isPodNotFound(err error) bool {
+	if grpc.Code(err) == codes.NotFound {
+		return true
+	}
+	msg := strings.ToLower(grpc.ErrorDesc(err))
+	for _, s := range podNotFoundErrors {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// removalQueue removes sandboxes in background, so that DeletePodSandbox
+// returns without waiting for the VM teardown. Pending removals are persisted
+// to a file and resumed after frakti restarts.
+type removalQueue struct {
+	sync.Mutex
+	path    string
+	pending map[string]bool
+	queue   chan string
+}
+
+func newRemovalQueue(path string) (*removalQueue, error) {
+	q := &removalQueue{
+		path:    path,
+		pending: make(map[string]bool),
+		queue:   make(chan string, removalQueueSize),
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(data) > 0 {
+		var podIDs []string
+		if err := json.Unmarshal(data, &podIDs); err != nil {
+			return nil, err
+		}
+		for _, podID := range podIDs {
+			q.pending[podID] = true
+		}
+	}
+	metrics.RemovalQueueDepth.Set(float64(len(q.pending)))
+
+	return q, nil
+}
+
+// add queues the removal of a sandbox, it is a no-op if already queued.
+func (q *removalQueue) add(podID string) error {
+	q.Lock()
+	if q.pending[podID] {
+		q.Unlock()
+		return nil
+	}
+
+	q.pending[podID] = true
+	if err := q.save(); err != nil {
+		delete(q.pending, podID)
+		q.Unlock()
+		return err
+	}
+	metrics.RemovalQueueDepth.Set(float64(len(q.pending)))
+	q.Unlock()
+
+	// Sent without the lock, so that a full queue doesn't block other adds.
+	q.queue <- podID
+	return nil
+}
+
+func (q *removalQueue) done(podID string) {
+	q.Lock()
+	defer q.Unlock()
+	delete(q.pending, podID)
+	if err := q.save(); err != nil {
+		glog.Warningf("Save removal queue to %s failed: %v", q.path, err)
+	}
+	metrics.RemovalQueueDepth.Set(float64(len(q.pending)))
+}
+
+func (q *removalQueue) list() []string {
+	q.Lock()
+	defer q.Unlock()
+	podIDs := make([]string, 0, len(q.pending))
+	for podID := range q.pending {
+		podIDs = append(podIDs, podID)
+	}
+	return podIDs
+}
+
+// save writes the pending removals to the queue file, it must be called
+// with the lock held.
+func (q *removalQueue) save() error {
+	podIDs := make([]string, 0, len(q.pending))
+	for podID := range q.pending {
+		podIDs = append(podIDs, podID)
+	}
+	data, err := json.Marshal(podIDs)
+	if err != nil {
+		return err
+	}
+
+	tmp := q.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, q.path)
+}
+
+// processRemovals removes the queued sandboxes, retrying failed removals
+// with backoff. Removals persisted by a previous run are resumed first.
+func (h *Runtime) processRemovals() {
+	for _, podID := range h.removals.list() {
+		go h.removeQueuedSandbox(podID)
+	}
+	for podID := range h.removals.queue {
+		go h.removeQueuedSandbox(podID)
+	}
+}
+
+func (h *Runtime) removeQueuedSandbox(podID string) {
+	backoff := removalBackoff
+	for attempt := 1; ; attempt++ {
+		err := h.removeSandbox(podID)
+		if err == nil || isPodNotFound(err) {
+			glog.V(3).Infof("Removed sandbox %q in background", podID)
+			h.removals.done(podID)
+			return
+		}
+
+		glog.Warningf("Remove sandbox %q in background failed (attempt %d): %v", podID, attempt, err)
+		if attempt >= removalMaxAttempts {
+			glog.Errorf("Give up removing sandbox %q after %d attempts", podID, attempt)
+			h.removals.done(podID)
+			return
+		}
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > removalMaxBackoff {
+			backoff = removalMaxBackoff
+		}
+	}
+}
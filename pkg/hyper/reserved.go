@@ -0,0 +1,79 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// vmMemoryOverheadMB is the memory consumed by each sandbox VM on top of
+	// its containers (guest kernel, hyperstart and the hypervisor process).
+	vmMemoryOverheadMB = 64
+	// vmCPUOverheadMilli is the CPU consumed by each sandbox VM on top of its
+	// containers, in millicores.
+	vmCPUOverheadMilli = 50
+
+	// daemonMemoryReservedMB and daemonCPUReservedMilli are reserved for
+	// frakti and hyperd themselves.
+	daemonMemoryReservedMB  = 128
+	daemonCPUReservedMilli  = 100
+	reservedFilePermissions = 0644
+)
+
+// ReservedResources describes the cpu (in millicores) and memory (in MB)
+// which should be reserved on a node.
+type ReservedResources struct {
+	CPUMilli int64
+	MemoryMB int64
+}
+
+// String returns the resources in kubelet's reserved flag format.
+func (r ReservedResources) String() string {
+	return fmt.Sprintf("cpu=%dm,memory=%dMi", r.CPUMilli, r.MemoryMB)
+}
+
+// ComputeReservedResources computes the recommended kube-reserved and
+// system-reserved values for a node running at most maxPods sandboxes and
+// keeping poolSize pre-created VMs. VM overhead isn't accounted in pod
+// cgroups, so it is reserved as system resources.
+func ComputeReservedResources(maxPods, poolSize int) (kubeReserved, systemReserved ReservedResources) {
+	vms := int64(maxPods + poolSize)
+	kubeReserved = ReservedResources{
+		CPUMilli: daemonCPUReservedMilli,
+		MemoryMB: daemonMemoryReservedMB,
+	}
+	systemReserved = ReservedResources{
+		CPUMilli: vms * vmCPUOverheadMilli,
+		MemoryMB: vms * vmMemoryOverheadMB,
+	}
+
+	return kubeReserved, systemReserved
+}
+
+// WriteReservedResources writes the recommended kubelet reserved flags to path,
+// so that kubelet config tooling could consume them.
+func WriteReservedResources(path string, maxPods, poolSize int) error {
+	kubeReserved, systemReserved := ComputeReservedResources(maxPods, poolSize)
+	content := fmt.Sprintf("--kube-reserved=%s\n--system-reserved=%s\n", kubeReserved, systemReserved)
+
+	glog.V(3).Infof("Writing reserved resources to %s: %q", path, content)
+	return ioutil.WriteFile(path, []byte(content), reservedFilePermissions)
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// resumeCheckInterval is the interval of checking host resume.
+	resumeCheckInterval = 10 * time.Second
+	// resumeClockJumpThreshold is the min difference between the elapsed
+	// boot time and monotonic clock regarded as a host suspend.
+	resumeClockJumpThreshold = 5 * time.Second
+
+	// Clock IDs of clock_gettime(2), which aren't in package syscall.
+	clockMonotonic = 1
+	clockBoottime  = 7
+)
+
+// clockGettime returns the time of the clock.
+func clockGettime(clock uintptr) (time.Duration, error) {
+	var ts syscall.Timespec
+	if _, _, errno := syscall.Syscall(syscall.SYS_CLOCK_GETTIME, clock, uintptr(unsafe.Pointer(&ts)), 0); errno != 0 {
+		return 0, errno
+	}
+	return time.Duration(ts.Nano()), nil
+}
+
+// suspendedTime returns the total time the host has been suspended since
+// boot, as CLOCK_BOOTTIME advances while suspended but CLOCK_MONOTONIC
+// doesn't.
+func suspendedTime() (time.Duration, error) {
+	boottime, err := clockGettime(clockBoottime)
+	if err != nil {
+		return 0, err
+	}
+	monotonic, err := clockGettime(clockMonotonic)
+	if err != nil {
+		return 0, err
+	}
+	return boottime - monotonic, nil
+}
+
+// watchHostResume detects the host resuming from suspend by the growth of
+// the suspended time.
+//
+// TODO: resync guest clocks on resume, which needs hyperstart to support
+// setting the guest time, kvmclock alone doesn't step it.
+func (h *Runtime) watchHostResume() {
+	last, err := suspendedTime()
+	if err != nil {
+		glog.Warningf("Get suspended time failed, host resume isn't detected: %v", err)
+		return
+	}
+
+	for range time.Tick(resumeCheckInterval) {
+		suspended, err := suspendedTime()
+		if err != nil {
+			glog.Warningf("Get suspended time failed: %v", err)
+			continue
+		}
+		jump := suspended - last
+		last = suspended
+		if jump < resumeClockJumpThreshold {
+			continue
+		}
+
+		glog.Warningf("Host was suspended for %v, resyncing sandboxes", jump)
+		h.resyncSandboxes()
+	}
+}
+
+// resyncSandboxes re-validates the network state of running sandboxes by
+// running the resync network hooks.
+func (h *Runtime) resyncSandboxes() {
+	if h.config.NetworkHooksDir == "" {
+		return
+	}
+
+	pods, err := h.client.ListPods()
+	if err != nil {
+		glog.Warningf("List pods for resyncing sandboxes failed: %v", err)
+		return
+	}
+
+	for _, pod := range pods {
+		if pod.Status != hyperPodPhaseRunning {
+			continue
+		}
+
+		info, err := h.client.GetPodInfo(pod.PodID)
+		if err != nil {
+			glog.Warningf("Get info of sandbox %q failed: %v", pod.PodID, err)
+			continue
+		}
+		if err := h.runNetworkHooks(networkHookResync, pod.PodID, pod.Labels, podIPs(info)); err != nil {
+			glog.Warningf("Resync network of sandbox %q failed: %v", pod.PodID, err)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"math"
+	goruntime "runtime"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/hyperhq/hyperd/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+const (
+	// default resources of a sandbox VM if not specified in PodSandboxConfig.
+	defaultCPUNumber         = 1
+	defaultMemoryinMegabytes = 64
+
+	megabyte = 1024 * 1024
+
+	// defaultShmSize is the size of /dev/shm mounted by hyperstart.
+	defaultShmSize = 64 * megabyte
+)
+
+// podOverhead returns the pod overhead (cpu in millicores and memory in bytes)
+// specified in the sandbox annotations.
+func podOverhead(config *kubeapi.PodSandboxConfig) (cpuMilli, memoryBytes int64, err error) {
+	annotations := config.GetAnnotations()
+	if v, ok := annotations[podOverheadCPUAnnotation]; ok {
+		if cpuMilli, err = parseCPUMilli(v); err != nil {
+			return 0, 0, err
+		}
+		if cpuMilli < vmCPUOverheadMilli {
+			glog.Warningf("CPU overhead %dm of sandbox %q doesn't cover the hypervisor cost %dm",
+				cpuMilli, config.GetName(), vmCPUOverheadMilli)
+		}
+	}
+
+	if v, ok := annotations[podOverheadMemoryAnnotation]; ok {
+		if memoryBytes, err = parseMemoryBytes(v); err != nil {
+			return 0, 0, err
+		}
+		if memoryBytes < vmMemoryOverheadMB*megabyte {
+			glog.Warningf("Memory overhead %d bytes of sandbox %q doesn't cover the hypervisor cost %dMi",
+				memoryBytes, config.GetName(), vmMemoryOverheadMB)
+		}
+	}
+
+	return cpuMilli, memoryBytes, nil
+}
+
+// sandboxResources computes the vcpu number and memory (in MB) of the sandbox VM,
+// including the pod overhead. The CPU limit and overhead are summed in
+// millicores before rounding up to whole vcpus.
+//
+// The overhead isn't applied to cgroup limits, as the cgroups of VMs on the
+// host are created and sized by hyperd, not by frakti.
+func sandboxResources(config *kubeapi.PodSandboxConfig, handler *RuntimeHandler) (int32, int32, error) {
+	overheadCPUMilli, overheadMemory, err := podOverhead(config)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	vcpu := float64(handler.DefaultCPU)
+	memory := float64(handler.DefaultMemoryMB) * megabyte
+	if resources := config.Resources; resources != nil {
+		if cpuLimits := resources.GetCpu().GetLimits(); cpuLimits > 0 {
+			vcpu = cpuLimits
+		}
+		if memoryLimits := resources.GetMemory().GetLimits(); memoryLimits > 0 {
+			memory = memoryLimits
+		}
+	}
+
+	memory += float64(overheadMemory)
+	cpuMilli := int64(math.Ceil(vcpu*1000-1e-6)) + overheadCPUMilli
+	vcpuNumber := int32((cpuMilli + 999) / 1000)
+	memoryMB := int32(math.Ceil(memory / megabyte))
+	if handler.MaxCPU > 0 && vcpuNumber > handler.MaxCPU {
+		return 0, 0, fmt.Errorf("sandbox requires %d vcpus, exceeding %d of its runtime handler", vcpuNumber, handler.MaxCPU)
+	}
+	if handler.MaxMemoryMB > 0 && memoryMB > handler.MaxMemoryMB {
+		return 0, 0, fmt.Errorf("sandbox requires %dMB memory, exceeding %dMB of its runtime handler", memoryMB, handler.MaxMemoryMB)
+	}
+
+	return vcpuNumber, memoryMB, nil
+}
+
+// validateShmSize checks the /dev/shm size requested by annotation.
+//
+// TODO: support sizing /dev/shm once hyperd's UserPod could carry it. It's
+// mounted by hyperstart with a fixed size and shared by all containers of
+// the sandbox, so other sizes are rejected up front instead of workloads
+// failing on a smaller shm than requested.
+func validateShmSize(config *kubeapi.PodSandboxConfig) error {
+	v, ok := config.GetAnnotations()[shmSizeAnnotation]
+	if !ok {
+		return nil
+	}
+
+	size, err := parseMemoryBytes(v)
+	if err != nil {
+		return err
+	}
+	if size != defaultShmSize {
+		return fmt.Errorf("shm size %q is not supported, only the default %dMi is available", v, defaultShmSize/megabyte)
+	}
+
+	return nil
+}
+
+// validateKernelModules checks the guest kernel modules requested by
+// annotation.
+//
+// TODO: load whitelisted modules in the guest at sandbox start and report
+// them. hyperstart has no API to load kernel modules, and the guest kernel
+// is shared by all sandboxes of hyperd, so requests are rejected up front
+// instead of workloads failing on missing modules.
+func validateKernelModules(config *kubeapi.PodSandboxConfig) error {
+	v, ok := config.GetAnnotations()[kernelModulesAnnotation]
+	if !ok || v == "" {
+		return nil
+	}
+
+	return fmt.Errorf("loading guest kernel modules %q is not supported by hyperd", v)
+}
+
+// validateGuestArch checks the guest architecture requested by annotation.
+//
+// TODO: support cross-arch sandboxes once hyperd could select the emulated
+// machine type, kernel and image platform per pod. Until then they are
+// rejected up front instead of booting a guest of the wrong architecture.
+func validateGuestArch(config *kubeapi.PodSandboxConfig) error {
+	arch, ok := config.GetAnnotations()[guestArchAnnotation]
+	if !ok || arch == goruntime.GOARCH {
+		return nil
+	}
+
+	return fmt.Errorf("guest architecture %q is not supported, only %q guests could be booted on this node", arch, goruntime.GOARCH)
+}
+
+// buildUserPod builds hyperd's UserPod spec from PodSandboxConfig.
+func buildUserPod(config *kubeapi.PodSandboxConfig, handler *RuntimeHandler) (*types.UserPod, error) {
+	if config == nil {
+		return nil, fmt.Errorf("sandbox config is nil")
+	}
+
+	if err := validateShmSize(config); err != nil {
+		return nil, err
+	}
+
+	if err := validateGuestArch(config); err != nil {
+		return nil, err
+	}
+
+	if err := validateKernelModules(config); err != nil {
+		return nil, err
+	}
+
+	if err := validateNetworkOptions(config); err != nil {
+		return nil, err
+	}
+
+	if err := validateNamespaceOptions(config); err != nil {
+		return nil, err
+	}
+
+	vcpu, memory, err := sandboxResources(config, handler)
+	if err != nil {
+		return nil, err
+	}
+
+	userpod := &types.UserPod{
+		Id:       config.GetName(),
+		Hostname: config.GetHostname(),
+		Labels:   sandboxLabels(config),
+		Dns:      config.GetDnsOptions().GetServers(),
+		Resource: &types.UserResource{
+			Vcpu:   vcpu,
+			Memory: memory,
+		},
+	}
+	if err := addTimezoneFile(userpod, config); err != nil {
+		return nil, err
+	}
+
+	return userpod, nil
+}
+
+// startSandbox boots the sandbox VM and waits for its guest agent becoming
+// ready. A SandboxNotReadyError is returned if any of them times out.
+//
+// TODO: pin QEMU IO threads and vhost-net threads to the NUMA node of the
+// VM's vCPUs and NIC once booted. hyperd doesn't expose the hypervisor
+// process or its thread IDs yet, so frakti can't place them by itself.
+func (h *Runtime) startSandbox(podID string, bootTimeout time.Duration) error {
+	err := h.client.StartPod(podID, bootTimeout)
+	if err != nil {
+		if grpc.Code(err) == codes.DeadlineExceeded {
+			return &SandboxNotReadyError{PodID: podID, Reason: reasonVMBootTimeout, Err: err}
+		}
+		return err
+	}
+
+	deadline := time.Now().Add(h.config.AgentHandshakeTimeout)
+	for {
+		info, err := h.client.GetPodInfo(podID)
+		if err == nil {
+			if info.Status != nil && info.Status.Phase == hyperPodPhaseRunning {
+				return nil
+			}
+			err = fmt.Errorf("pod is not running yet")
+		}
+
+		if time.Now().After(deadline) {
+			return &SandboxNotReadyError{PodID: podID, Reason: reasonAgentHandshakeTimeout, Err: err}
+		}
+		time.Sleep(sandboxReadyPollingInterval)
+	}
+}
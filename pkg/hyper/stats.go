@@ -0,0 +1,256 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/hyperhq/hyperd/types"
+
+	"k8s.io/frakti/pkg/metrics"
+)
+
+const (
+	nanosecondsPerSecond = float64(time.Second)
+)
+
+// sandboxStats is the latest collected statistics of a sandbox.
+type sandboxStats struct {
+	pod   *types.PodListResult
+	stats *types.PodStats
+}
+
+// statsCache keeps the latest collected statistics of all running sandboxes.
+type statsCache struct {
+	sync.RWMutex
+	sandboxes map[string]*sandboxStats
+}
+
+func newStatsCache() *statsCache {
+	return &statsCache{
+		sandboxes: make(map[string]*sandboxStats),
+	}
+}
+
+func (c *statsCache) set(sandboxes map[string]*sandboxStats) {
+	c.Lock()
+	defer c.Unlock()
+	c.sandboxes = sandboxes
+}
+
+func (c *statsCache) get() map[string]*sandboxStats {
+	c.RLock()
+	defer c.RUnlock()
+	return c.sandboxes
+}
+
+// collectStats periodically collects the statistics of running sandboxes and
+// exports them as metrics. Statistics of all containers in a sandbox are got
+// by a single PodStats call, rather than one call per container.
+//
+// TODO: let hyperstart push statistics periodically in batch instead of
+// being polled through hyperd, which needs a new agent channel in both.
+func (h *Runtime) collectStats() {
+	cgroups := newVMCgroups()
+	for range time.Tick(h.config.StatsInterval) {
+		pods, err := h.client.ListPods()
+		if err != nil {
+			glog.Warningf("List pods for collecting stats failed: %v", err)
+			continue
+		}
+
+		values := make(sandboxMetricValues)
+		sandboxes := make(map[string]*sandboxStats, len(pods))
+		vmIDs := make(map[string]bool, len(pods))
+		for _, pod := range pods {
+			if pod.Status != hyperPodPhaseRunning {
+				continue
+			}
+
+			stats, err := h.client.GetPodStats(pod.PodID)
+			if isUnimplemented(err) {
+				h.capabilities.disable(capabilityStats, err)
+				return
+			}
+			if err != nil {
+				glog.V(4).Infof("Get stats of sandbox %q failed: %v", pod.PodID, err)
+				continue
+			}
+			values.setSandbox(pod, stats)
+			sandboxes[pod.PodID] = &sandboxStats{pod: pod, stats: stats}
+
+			vmIDs[pod.VmID] = true
+			throttling, err := cgroups.cpuThrottling(pod.VmID)
+			if err != nil {
+				glog.V(5).Infof("Get CPU throttling of sandbox %q failed: %v", pod.PodID, err)
+				continue
+			}
+			values.setThrottling(pod, throttling)
+		}
+		cgroups.prune(vmIDs)
+		values.replace()
+		h.stats.set(sandboxes)
+	}
+}
+
+// sandboxMetricVecs are the metrics of sandboxes, whose values are replaced
+// by each collection, so that removed sandboxes are not exported.
+var sandboxMetricVecs = []*metrics.GaugeVec{
+	metrics.SandboxCPUUsage,
+	metrics.SandboxCPUPeriods,
+	metrics.SandboxCPUThrottledPeriods,
+	metrics.SandboxCPUThrottledTime,
+	metrics.SandboxNetworkBytes,
+	metrics.SandboxNetworkPackets,
+	metrics.SandboxNetworkErrors,
+	metrics.SandboxNetworkDropped,
+	metrics.ContainerCPUUsage,
+	metrics.ContainerMemoryUsage,
+	metrics.ContainerMemoryFailures,
+	metrics.ContainerPageFaults,
+	metrics.ContainerFsUsage,
+	metrics.ContainerBlkioBytes,
+	metrics.ContainerBlkioOperations,
+}
+
+// sandboxMetricValues are the values of sandbox metrics built up by a
+// collection, before replacing the exported ones all at once. Otherwise a
+// scrape during the collection could observe metrics missing.
+type sandboxMetricValues map[*metrics.GaugeVec]*metrics.GaugeValues
+
+func (v sandboxMetricValues) set(vec *metrics.GaugeVec, value float64, labelValues ...string) {
+	values, ok := v[vec]
+	if !ok {
+		values = vec.NewValues()
+		v[vec] = values
+	}
+	values.Set(value, labelValues...)
+}
+
+// replace replaces the values of all sandbox metrics, including those with
+// no values collected.
+func (v sandboxMetricValues) replace() {
+	for _, vec := range sandboxMetricVecs {
+		values, ok := v[vec]
+		if !ok {
+			values = vec.NewValues()
+		}
+		vec.Replace(values)
+	}
+}
+
+// setSandbox sets the statistics of a sandbox and its containers.
+func (v sandboxMetricValues) setSandbox(pod *types.PodListResult, stats *types.PodStats) {
+	namespace, name := pod.Labels[kubernetesPodNamespaceLabel], pod.Labels[kubernetesPodNameLabel]
+	if usage := stats.GetCpu().GetUsage(); usage != nil {
+		v.set(metrics.SandboxCPUUsage, float64(usage.User)/nanosecondsPerSecond, pod.PodID, namespace, name, "user")
+		v.set(metrics.SandboxCPUUsage, float64(usage.System)/nanosecondsPerSecond, pod.PodID, namespace, name, "system")
+	}
+
+	for _, iface := range stats.GetNetwork().GetInterfaces() {
+		labels := []string{pod.PodID, namespace, name, iface.Name}
+		v.set(metrics.SandboxNetworkBytes, float64(iface.RxBytes), append(labels, "receive")...)
+		v.set(metrics.SandboxNetworkBytes, float64(iface.TxBytes), append(labels, "transmit")...)
+		v.set(metrics.SandboxNetworkPackets, float64(iface.RxPackets), append(labels, "receive")...)
+		v.set(metrics.SandboxNetworkPackets, float64(iface.TxPackets), append(labels, "transmit")...)
+		v.set(metrics.SandboxNetworkErrors, float64(iface.RxErrors), append(labels, "receive")...)
+		v.set(metrics.SandboxNetworkErrors, float64(iface.TxErrors), append(labels, "transmit")...)
+		v.set(metrics.SandboxNetworkDropped, float64(iface.RxDropped), append(labels, "receive")...)
+		v.set(metrics.SandboxNetworkDropped, float64(iface.TxDropped), append(labels, "transmit")...)
+	}
+
+	for _, container := range stats.ContainersStats {
+		if usage := container.GetCpu().GetUsage(); usage != nil {
+			v.set(metrics.ContainerCPUUsage, float64(usage.User)/nanosecondsPerSecond, pod.PodID, namespace, container.ContainerID, "user")
+			v.set(metrics.ContainerCPUUsage, float64(usage.System)/nanosecondsPerSecond, pod.PodID, namespace, container.ContainerID, "system")
+		}
+		v.setMemory(pod.PodID, namespace, container)
+		v.setBlkio(pod.PodID, namespace, container)
+		v.setFs(pod.PodID, namespace, container)
+	}
+}
+
+// setThrottling sets the CPU throttling of the VM of a sandbox on host.
+func (v sandboxMetricValues) setThrottling(pod *types.PodListResult, throttling *cpuThrottling) {
+	namespace, name := pod.Labels[kubernetesPodNamespaceLabel], pod.Labels[kubernetesPodNameLabel]
+	v.set(metrics.SandboxCPUPeriods, float64(throttling.periods), pod.PodID, namespace, name)
+	v.set(metrics.SandboxCPUThrottledPeriods, float64(throttling.throttledPeriods), pod.PodID, namespace, name)
+	v.set(metrics.SandboxCPUThrottledTime, float64(throttling.throttledTime)/nanosecondsPerSecond, pod.PodID, namespace, name)
+}
+
+// setMemory sets the memory statistics of a container. The
+// working set follows cadvisor semantics (usage minus inactive file pages) as
+// computed by hyperstart in guest, so it could be compared with kubelet's
+// eviction thresholds directly.
+//
+// TODO: break usage down into rss, cache and swap once hyperd reports them
+// in MemoryStats.
+func (v sandboxMetricValues) setMemory(podID, namespace string, container *types.ContainersStats) {
+	memory := container.GetMemory()
+	if memory == nil {
+		return
+	}
+
+	v.set(metrics.ContainerMemoryUsage, float64(memory.Usage), podID, namespace, container.ContainerID, "usage")
+	v.set(metrics.ContainerMemoryUsage, float64(memory.WorkingSet), podID, namespace, container.ContainerID, "working_set")
+	v.set(metrics.ContainerMemoryFailures, float64(memory.Failcnt), podID, namespace, container.ContainerID)
+	if data := memory.GetContainerData(); data != nil {
+		v.set(metrics.ContainerPageFaults, float64(data.Pgfault), podID, namespace, container.ContainerID, "pgfault")
+		v.set(metrics.ContainerPageFaults, float64(data.Pgmajfault), podID, namespace, container.ContainerID, "pgmajfault")
+	}
+}
+
+// blkioOperations are the blkio operations exported, as named by cgroup.
+var blkioOperations = []string{"Read", "Write"}
+
+// setBlkio sets the block IO statistics of a container, summed
+// over all devices.
+func (v sandboxMetricValues) setBlkio(podID, namespace string, container *types.ContainersStats) {
+	block := container.GetBlock()
+	if block == nil {
+		return
+	}
+
+	for _, op := range blkioOperations {
+		v.set(metrics.ContainerBlkioBytes, sumBlkioStat(block.IoServiceBytesRecursive, op), podID, namespace, container.ContainerID, strings.ToLower(op))
+		v.set(metrics.ContainerBlkioOperations, sumBlkioStat(block.IoServicedRecursive, op), podID, namespace, container.ContainerID, strings.ToLower(op))
+	}
+}
+
+func sumBlkioStat(entries []*types.BlkioStatEntry, op string) float64 {
+	var sum uint64
+	for _, entry := range entries {
+		sum += entry.Stat[op]
+	}
+	return float64(sum)
+}
+
+// setFs sets the filesystem usage of a container, so that disk
+// pressure of sandboxes could be watched by eviction tooling.
+//
+// TODO: reclaim disks of exited containers when capacity crosses a threshold,
+// once hyperd supports removing a single container of a pod.
+func (v sandboxMetricValues) setFs(podID, namespace string, container *types.ContainersStats) {
+	for _, fs := range container.Filesystem {
+		v.set(metrics.ContainerFsUsage, float64(fs.Usage), podID, namespace, container.ContainerID, fs.Device, "usage")
+		v.set(metrics.ContainerFsUsage, float64(fs.Limit), podID, namespace, container.ContainerID, fs.Device, "limit")
+		v.set(metrics.ContainerFsUsage, float64(fs.Available), podID, namespace, container.ContainerID, fs.Device, "available")
+	}
+}
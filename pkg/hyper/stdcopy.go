@@ -0,0 +1,77 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	// stdWriterPrefixLen is the length of the frame header of multiplexed
+	// stdout/stderr stream: [stream type, 0, 0, 0, size uint32 big endian].
+	stdWriterPrefixLen = 8
+	stdWriterFdIndex   = 0
+	stdWriterSizeIndex = 4
+
+	stdoutStreamType = 1
+	stderrStreamType = 2
+)
+
+// stdDemuxWriter demultiplexes the stdout/stderr frames of non-TTY exec
+// output (which is the same as docker's stdcopy format) into separate
+// stdout and stderr writers. Frames could be split across writes.
+type stdDemuxWriter struct {
+	stdout io.Writer
+	stderr io.Writer
+	buf    []byte
+}
+
+func newStdDemuxWriter(stdout, stderr io.Writer) *stdDemuxWriter {
+	return &stdDemuxWriter{stdout: stdout, stderr: stderr}
+}
+
+// Write implements io.Writer.
+func (w *stdDemuxWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+
+	for len(w.buf) >= stdWriterPrefixLen {
+		size := int(binary.BigEndian.Uint32(w.buf[stdWriterSizeIndex:stdWriterPrefixLen]))
+		if len(w.buf) < stdWriterPrefixLen+size {
+			break
+		}
+
+		var out io.Writer
+		switch w.buf[stdWriterFdIndex] {
+		case stdoutStreamType:
+			out = w.stdout
+		case stderrStreamType:
+			out = w.stderr
+		default:
+			return 0, fmt.Errorf("unrecognized stream type %d", w.buf[stdWriterFdIndex])
+		}
+
+		frame := w.buf[stdWriterPrefixLen : stdWriterPrefixLen+size]
+		if _, err := out.Write(frame); err != nil {
+			return 0, err
+		}
+		w.buf = w.buf[stdWriterPrefixLen+size:]
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,219 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/hyperhq/hyperd/types"
+	"golang.org/x/net/context"
+)
+
+const (
+	// stopSignalLabel and exposedPortsLabel record the STOPSIGNAL and the
+	// exposed ports of the image on hyper containers, as hyperd's ImageInfo
+	// doesn't report them.
+	stopSignalLabel   = annotationPrefix + "stop-signal"
+	exposedPortsLabel = annotationPrefix + "exposed-ports"
+	// hyperImageDBPattern matches the directories of image configs in
+	// hyperd's image store, one per graph driver.
+	hyperImageDBPattern = hyperRootDir + "/image/*/imagedb/content/sha256"
+	// containerStopPollInterval is the interval of checking whether a
+	// signaled container exited.
+	containerStopPollInterval = 500 * time.Millisecond
+	// hyperContainerPhaseRunning is the phase of running hyper containers.
+	hyperContainerPhaseRunning = "running"
+)
+
+// signals are the signals which could be named by STOPSIGNAL.
+var signals = map[string]syscall.Signal{
+	"HUP":   syscall.SIGHUP,
+	"INT":   syscall.SIGINT,
+	"QUIT":  syscall.SIGQUIT,
+	"ABRT":  syscall.SIGABRT,
+	"KILL":  syscall.SIGKILL,
+	"USR1":  syscall.SIGUSR1,
+	"USR2":  syscall.SIGUSR2,
+	"TERM":  syscall.SIGTERM,
+	"STOP":  syscall.SIGSTOP,
+	"WINCH": syscall.SIGWINCH,
+	"PWR":   syscall.SIGPWR,
+}
+
+// parseSignal parses a signal by name, e.g. "SIGQUIT" or "QUIT", or by
+// number.
+func parseSignal(s string) (syscall.Signal, error) {
+	if n, err := strconv.Atoi(s); err == nil && n > 0 && n < 65 {
+		return syscall.Signal(n), nil
+	}
+	if sig, ok := signals[strings.TrimPrefix(strings.ToUpper(s), "SIG")]; ok {
+		return sig, nil
+	}
+	return 0, fmt.Errorf("invalid signal %q", s)
+}
+
+// imageConfig is the part of docker image configs used by frakti.
+type imageConfig struct {
+	Config struct {
+		StopSignal   string              `json:"StopSignal"`
+		ExposedPorts map[string]struct{} `json:"ExposedPorts"`
+	} `json:"config"`
+}
+
+// readImageConfig reads the config of the local image from hyperd's image
+// store.
+func (h *Runtime) readImageConfig(image string) (*imageConfig, error) {
+	info, err := h.findImage(image)
+	if err != nil {
+		return nil, err
+	}
+	if info == nil {
+		return nil, fmt.Errorf("image %q not found", image)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(hyperImageDBPattern, strings.TrimPrefix(info.Id, "sha256:")))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("config of image %q not found in %s", image, hyperImageDBPattern)
+	}
+
+	data, err := ioutil.ReadFile(paths[0])
+	if err != nil {
+		return nil, err
+	}
+	config := &imageConfig{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("parse config of image %q failed: %v", image, err)
+	}
+	return config, nil
+}
+
+// addImageConfigLabels records the STOPSIGNAL and exposed ports of the
+// container image as its labels, so that StopContainer honors the signal and
+// the ports could be seen when debugging. Images whose config can't be read
+// are stopped by SIGTERM.
+func (h *Runtime) addImageConfigLabels(spec *types.UserContainer) {
+	config, err := h.readImageConfig(spec.Image)
+	if err != nil {
+		glog.V(4).Infof("Read config of image %q failed: %v", spec.Image, err)
+		return
+	}
+
+	labels := make(map[string]string, len(spec.Labels)+2)
+	for k, v := range spec.Labels {
+		labels[k] = v
+	}
+	if signal := config.Config.StopSignal; signal != "" {
+		if _, err := parseSignal(signal); err != nil {
+			glog.Warningf("Ignore stop signal of image %q: %v", spec.Image, err)
+		} else {
+			labels[stopSignalLabel] = signal
+		}
+	}
+	if len(config.Config.ExposedPorts) > 0 {
+		ports := make([]string, 0, len(config.Config.ExposedPorts))
+		for port := range config.Config.ExposedPorts {
+			ports = append(ports, port)
+		}
+		sort.Strings(ports)
+		labels[exposedPortsLabel] = strings.Join(ports, ",")
+	}
+	spec.Labels = labels
+}
+
+// stopContainer stops the container. Containers whose image has a
+// STOPSIGNAL other than SIGTERM get the signal first, and are stopped by
+// hyperd only if they haven't exited within timeout seconds. hyperd's
+// ContainerStop can't take a signal, so the signal is sent by kill exec'd in
+// the container, which needs the image to have kill.
+func (h *Runtime) stopContainer(containerID string, timeout int64) error {
+	info, err := h.client.GetContainerInfo(containerID)
+	if err != nil {
+		return err
+	}
+	if !isContainerRunning(info) {
+		return nil
+	}
+
+	if v, ok := info.GetContainer().GetLabels()[stopSignalLabel]; ok {
+		signal, err := parseSignal(v)
+		if err == nil && signal != syscall.SIGTERM {
+			if err := h.signalContainer(containerID, signal); err != nil {
+				glog.Warningf("Send stop signal %s to container %q failed, stopping it by SIGTERM: %v", v, containerID, err)
+			} else if h.waitContainerExit(containerID, time.Duration(timeout)*time.Second) {
+				return nil
+			}
+		}
+	}
+
+	return h.client.StopContainer(containerID)
+}
+
+// signalContainer sends the signal to the init process of the container.
+func (h *Runtime) signalContainer(containerID string, signal syscall.Signal) error {
+	cmd := []string{"kill", fmt.Sprintf("-%d", signal), "1"}
+	execID, err := h.client.CreateExec(containerID, cmd, false)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hyperConnectionTimeout)
+	defer cancel()
+	if err := h.client.StartExec(ctx, containerID, execID, nil, ioutil.Discard); err != nil {
+		return err
+	}
+
+	exitCode, err := h.client.Wait(containerID, execID, false)
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("%v exited with %d", cmd, exitCode)
+	}
+	return nil
+}
+
+// waitContainerExit returns whether the container exits within timeout.
+func (h *Runtime) waitContainerExit(containerID string, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		info, err := h.client.GetContainerInfo(containerID)
+		if err == nil && !isContainerRunning(info) {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(containerStopPollInterval)
+	}
+}
+
+func isContainerRunning(info *types.ContainerInfo) bool {
+	status := info.GetStatus()
+	return status != nil && strings.ToLower(status.Phase) == hyperContainerPhaseRunning
+}
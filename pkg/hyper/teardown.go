@@ -0,0 +1,158 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/frakti/pkg/metrics"
+)
+
+const (
+	// networkTeardownRetries is the number of attempts of a network teardown
+	// during sandbox deletion.
+	networkTeardownRetries = 3
+	// networkTeardownBackoff is the initial backoff between teardown attempts,
+	// doubled after each attempt.
+	networkTeardownBackoff = 500 * time.Millisecond
+	// networkTeardownRetryInterval is the interval of retrying failed teardowns.
+	networkTeardownRetryInterval = time.Minute
+)
+
+// networkTeardowns tracks sandbox networks whose teardown failed, and retries
+// them in background so that leaked network resources are eventually released.
+// Pending teardowns are persisted to a file if path is set.
+type networkTeardowns struct {
+	sync.Mutex
+	path string
+	// pending maps sandbox IDs to their labels.
+	pending map[string]map[string]string
+}
+
+func newNetworkTeardowns(path string) (*networkTeardowns, error) {
+	t := &networkTeardowns{
+		path:    path,
+		pending: make(map[string]map[string]string),
+	}
+	if path == "" {
+		return t, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &t.pending); err != nil {
+			return nil, err
+		}
+	}
+	metrics.LeakedSandboxNetworks.Set(float64(len(t.pending)))
+
+	return t, nil
+}
+
+func (t *networkTeardowns) add(podID string, labels map[string]string) {
+	t.Lock()
+	defer t.Unlock()
+	t.pending[podID] = labels
+	t.save()
+	metrics.LeakedSandboxNetworks.Set(float64(len(t.pending)))
+}
+
+func (t *networkTeardowns) remove(podID string) {
+	t.Lock()
+	defer t.Unlock()
+	delete(t.pending, podID)
+	t.save()
+	metrics.LeakedSandboxNetworks.Set(float64(len(t.pending)))
+}
+
+func (t *networkTeardowns) list() map[string]map[string]string {
+	t.Lock()
+	defer t.Unlock()
+	pending := make(map[string]map[string]string, len(t.pending))
+	for podID, labels := range t.pending {
+		pending[podID] = labels
+	}
+	return pending
+}
+
+// save writes the pending teardowns to the file, it must be called with the
+// lock held. Failures are only logged, as the teardowns are still retried
+// until frakti restarts.
+func (t *networkTeardowns) save() {
+	if t.path == "" {
+		return
+	}
+
+	data, err := json.Marshal(t.pending)
+	if err == nil {
+		tmp := t.path + ".tmp"
+		if err = ioutil.WriteFile(tmp, data, 0600); err == nil {
+			err = os.Rename(tmp, t.path)
+		}
+	}
+	if err != nil {
+		glog.Warningf("Save network teardowns to %s failed: %v", t.path, err)
+	}
+}
+
+// teardownSandboxNetwork runs the remove network hooks of a sandbox with
+// retries. If all attempts fail, the teardown is queued for background retry.
+func (h *Runtime) teardownSandboxNetwork(podID string, labels map[string]string) {
+	backoff := networkTeardownBackoff
+	for attempt := 1; ; attempt++ {
+		err := h.runNetworkHooks(networkHookRemove, podID, labels, nil)
+		if err == nil {
+			return
+		}
+
+		metrics.NetworkTeardownErrors.Inc()
+		if attempt == networkTeardownRetries {
+			glog.Errorf("Teardown network of sandbox %q failed after %d attempts, queued for retry: %v", podID, attempt, err)
+			h.networkTeardowns.add(podID, labels)
+			return
+		}
+
+		glog.Warningf("Teardown network of sandbox %q failed (attempt %d): %v", podID, attempt, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// retryNetworkTeardowns periodically retries the failed network teardowns.
+func (h *Runtime) retryNetworkTeardowns() {
+	for range time.Tick(networkTeardownRetryInterval) {
+		for podID, labels := range h.networkTeardowns.list() {
+			if err := h.runNetworkHooks(networkHookRemove, podID, labels, nil); err != nil {
+				metrics.NetworkTeardownErrors.Inc()
+				glog.Warningf("Retry teardown network of sandbox %q failed: %v", podID, err)
+				continue
+			}
+
+			glog.V(3).Infof("Teardown network of sandbox %q succeeded on retry", podID)
+			h.networkTeardowns.remove(podID)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	procPath       = "/proc"
+	cgroupRootPath = "/sys/fs/cgroup"
+)
+
+// cpuThrottling is the CPU quota throttling of a cgroup.
+type cpuThrottling struct {
+	periods          uint64
+	throttledPeriods uint64
+	// throttledTime is in nanoseconds.
+	throttledTime uint64
+}
+
+// vmCgroups finds the host cgroups of sandbox VMs, so that throttling of
+// the VMs by their CPU quota could be exported. hyperd doesn't report it,
+// so the cgroup of the hypervisor process, whose command line contains the
+// VM ID, is read directly. The cpu.stat paths found are cached by VM ID.
+//
+// TODO: export throttling of each container cgroup in guest once hyperd
+// reports it in CpuStats, guest cgroups aren't reachable from host.
+type vmCgroups struct {
+	paths map[string]string
+}
+
+func newVMCgroups() *vmCgroups {
+	return &vmCgroups{paths: make(map[string]string)}
+}
+
+// cpuThrottling returns the CPU throttling of the VM.
+func (c *vmCgroups) cpuThrottling(vmID string) (*cpuThrottling, error) {
+	path, ok := c.paths[vmID]
+	if !ok {
+		pid, err := findVMProcess(vmID)
+		if err != nil {
+			return nil, err
+		}
+		path, err = cpuStatPath(pid)
+		if err != nil {
+			return nil, err
+		}
+		c.paths[vmID] = path
+	}
+
+	throttling, err := readCPUThrottling(path)
+	if err != nil {
+		// The VM may have been restarted in another cgroup.
+		delete(c.paths, vmID)
+		return nil, err
+	}
+	return throttling, nil
+}
+
+// prune forgets VMs not in vmIDs.
+func (c *vmCgroups) prune(vmIDs map[string]bool) {
+	for vmID := range c.paths {
+		if !vmIDs[vmID] {
+			delete(c.paths, vmID)
+		}
+	}
+}
+
+// findVMProcess returns the pid of the hypervisor process of the VM.
+func findVMProcess(vmID string) (int, error) {
+	if vmID == "" {
+		return 0, fmt.Errorf("empty VM ID")
+	}
+
+	entries, err := ioutil.ReadDir(procPath)
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		cmdline, err := ioutil.ReadFile(filepath.Join(procPath, entry.Name(), "cmdline"))
+		if err != nil {
+			continue
+		}
+		for _, arg := range strings.Split(string(cmdline), "\x00") {
+			if strings.Contains(arg, vmID) {
+				return pid, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("process of VM %q not found", vmID)
+}
+
+// cpuStatPath returns the path of cpu.stat of the cgroup of pid, for both
+// cgroup v1 and the unified hierarchy of v2.
+func cpuStatPath(pid int) (string, error) {
+	f, err := os.Open(filepath.Join(procPath, strconv.Itoa(pid), "cgroup"))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var candidates []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Lines are formatted as "hierarchy-ID:controller-list:cgroup-path".
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		switch {
+		case parts[1] == "":
+			candidates = append(candidates,
+				filepath.Join(cgroupRootPath, parts[2], "cpu.stat"),
+				filepath.Join(cgroupRootPath, "unified", parts[2], "cpu.stat"))
+		case contains(strings.Split(parts[1], ","), "cpu"):
+			candidates = append(candidates,
+				filepath.Join(cgroupRootPath, parts[1], parts[2], "cpu.stat"),
+				filepath.Join(cgroupRootPath, "cpu", parts[2], "cpu.stat"))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	for _, path := range candidates {
+		if _, err := readCPUThrottling(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("cpu.stat of process %d not found", pid)
+}
+
+// readCPUThrottling reads the throttling in cpu.stat, whose throttled time
+// is throttled_time in nanoseconds in cgroup v1 and throttled_usec in v2.
+func readCPUThrottling(path string) (*cpuThrottling, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var throttling cpuThrottling
+	found := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s in %s: %v", fields[0], path, err)
+		}
+		switch fields[0] {
+		case "nr_periods":
+			throttling.periods = value
+			found = true
+		case "nr_throttled":
+			throttling.throttledPeriods = value
+		case "throttled_time":
+			throttling.throttledTime = value
+		case "throttled_usec":
+			throttling.throttledTime = value * 1000
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("nr_periods not found in %s", path)
+	}
+	return &throttling, nil
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hyperhq/hyperd/types"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+const (
+	// timezoneHost selects the host time zone by the timezone annotation.
+	timezoneHost  = "host"
+	hostLocaltime = "/etc/localtime"
+	zoneinfoDir   = "/usr/share/zoneinfo"
+	localtimeFile = "localtime"
+	fileURIScheme = "file://"
+	// timezoneFileLabel marks hyper pods given the localtime file, as hyperd
+	// doesn't report pod files.
+	timezoneFileLabel = timezoneAnnotation
+)
+
+// timezoneFile returns the host file of the time zone selected by the
+// sandbox annotation, or empty if none is selected.
+func timezoneFile(config *kubeapi.PodSandboxConfig) (string, error) {
+	zone, ok := config.GetAnnotations()[timezoneAnnotation]
+	if !ok || zone == "" {
+		return "", nil
+	}
+	if zone == timezoneHost {
+		return hostLocaltime, nil
+	}
+
+	if filepath.IsAbs(zone) || strings.Contains(zone, "..") {
+		return "", fmt.Errorf("invalid time zone %q", zone)
+	}
+	path := filepath.Join(zoneinfoDir, zone)
+	if info, err := os.Stat(path); err != nil || info.IsDir() {
+		return "", fmt.Errorf("time zone %q is not found in %s", zone, zoneinfoDir)
+	}
+	return path, nil
+}
+
+// addTimezoneFile adds the time zone file selected by the sandbox annotation
+// to the pod, so its containers could be given /etc/localtime even if their
+// images lack time zone data.
+func addTimezoneFile(userpod *types.UserPod, config *kubeapi.PodSandboxConfig) error {
+	path, err := timezoneFile(config)
+	if err != nil || path == "" {
+		return err
+	}
+
+	userpod.Files = append(userpod.Files, &types.UserFile{
+		Name:     localtimeFile,
+		Encoding: "raw",
+		Uri:      fileURIScheme + path,
+	})
+
+	labels := make(map[string]string, len(userpod.Labels)+1)
+	for k, v := range userpod.Labels {
+		labels[k] = v
+	}
+	labels[timezoneFileLabel] = "true"
+	userpod.Labels = labels
+	return nil
+}
+
+// setupTimezone gives the container the /etc/localtime of its sandbox's time
+// zone, if the sandbox was created with one. TZ isn't set, as libc would
+// resolve a zone name against the image's missing time zone data instead of
+// /etc/localtime.
+//
+// TODO: inject locale files as well. Locales are directories, while hyperd
+// only injects single files into containers.
+func (h *Runtime) setupTimezone(podSandBoxID string, container *types.UserContainer) error {
+	info, err := h.client.GetPodInfo(podSandBoxID)
+	if err != nil {
+		return err
+	}
+	if info.Spec == nil || info.Spec.Labels[timezoneFileLabel] != "true" {
+		return nil
+	}
+
+	container.Files = append(container.Files, &types.UserFileReference{
+		Path:     hostLocaltime,
+		Filename: localtimeFile,
+		Perm:     "0644",
+	})
+	return nil
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+const (
+	// maxMetadataSize is the max total size of labels and annotations, the
+	// same as kubernetes' limit of annotations.
+	maxMetadataSize = 256 * 1024
+)
+
+var (
+	hostnameRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+	envNameRegexp  = regexp.MustCompile(`^[^=\x00]+$`)
+)
+
+// fieldErrors collects field-level validation errors.
+type fieldErrors []string
+
+func (e *fieldErrors) add(field, format string, args ...interface{}) {
+	*e = append(*e, field+": "+fmt.Sprintf(format, args...))
+}
+
+// toError returns an InvalidArgument error with all field errors, or nil if
+// there isn't any.
+func (e fieldErrors) toError(kind string) error {
+	if len(e) == 0 {
+		return nil
+	}
+	return grpc.Errorf(codes.InvalidArgument, "invalid %s config: %s", kind, strings.Join(e, "; "))
+}
+
+func validateMetadata(errs *fieldErrors, labels, annotations map[string]string) {
+	size := 0
+	for i, m := range []map[string]string{labels, annotations} {
+		for k, v := range m {
+			if k == "" {
+				errs.add([]string{"labels", "annotations"}[i], "empty key")
+			}
+			size += len(k) + len(v)
+		}
+	}
+	if size > maxMetadataSize {
+		errs.add("labels", "total size of labels and annotations %d exceeds %d", size, maxMetadataSize)
+	}
+}
+
+// validatePodSandboxConfig checks the sandbox config up front, so that bad
+// configs fail with field-level messages instead of deep inside hyperd.
+func validatePodSandboxConfig(config *kubeapi.PodSandboxConfig) error {
+	if config == nil {
+		return grpc.Errorf(codes.InvalidArgument, "sandbox config is nil")
+	}
+
+	var errs fieldErrors
+	if config.GetName() == "" {
+		errs.add("name", "required")
+	}
+	if hostname := config.GetHostname(); hostname != "" && !hostnameRegexp.MatchString(hostname) {
+		errs.add("hostname", "%q is not a valid DNS label", hostname)
+	}
+	for i, server := range config.GetDnsOptions().GetServers() {
+		if net.ParseIP(server) == nil {
+			errs.add(fmt.Sprintf("dns_options.servers[%d]", i), "%q is not a valid IP", server)
+		}
+	}
+	// kubelet sends a mapping for each declared container port, which is
+	// reachable on the sandbox IP anyway. Only host ports can't be honored.
+	for i, mapping := range config.GetPortMappings() {
+		if mapping.GetHostPort() != 0 {
+			errs.add(fmt.Sprintf("port_mappings[%d].host_port", i), "not supported")
+		}
+	}
+	validateMetadata(&errs, config.GetLabels(), config.GetAnnotations())
+
+	return errs.toError("sandbox")
+}
+
+// validateContainerConfig checks the container config up front, so that bad
+// configs fail with field-level messages instead of deep inside hyperd.
+// maxEnvSize is the max total size of environment variables, 0 means
+// unlimited.
+func validateContainerConfig(config *kubeapi.ContainerConfig, maxEnvSize int) error {
+	if config == nil {
+		return grpc.Errorf(codes.InvalidArgument, "container config is nil")
+	}
+
+	var errs fieldErrors
+	if config.GetName() == "" {
+		errs.add("name", "required")
+	}
+	if config.GetImage().GetImage() == "" {
+		errs.add("image", "required")
+	}
+	if dir := config.GetWorkingDir(); dir != "" && !filepath.IsAbs(dir) {
+		errs.add("working_dir", "%q is not an absolute path", dir)
+	}
+	envSize := 0
+	for i, env := range config.GetEnvs() {
+		if !envNameRegexp.MatchString(env.GetKey()) {
+			errs.add(fmt.Sprintf("envs[%d]", i), "invalid name %q", env.GetKey())
+		}
+		// Values are passed as is, "=" and newlines included. The size is
+		// counted as "key=value\0" like in the process environment.
+		envSize += len(env.GetKey()) + len(env.GetValue()) + 2
+	}
+	if maxEnvSize > 0 && envSize > maxEnvSize {
+		errs.add("envs", "total size %d exceeds %d", envSize, maxEnvSize)
+	}
+	// TODO: mount RWX volumes which can't be shared from the host (e.g. NFS
+	// exports) by an in-guest client, with per-volume credentials. hyperstart
+	// has no API to mount network filesystems in the guest.
+	//
+	// TODO: apply fsGroup ownership to volumes in the guest with an
+	// OnRootMismatch style policy, skipping the recursive chown when the volume
+	// root already matches. The runtime API doesn't carry fsGroup, and kubelet
+	// chowns volumes on the host before they are shared with the VM.
+	//
+	// TODO: check subPath mounts can't escape their volume through symlinks.
+	// The runtime API only carries the host path already joined and cleaned
+	// by kubelet, so neither the volume nor the subPath is known here.
+	for i, mount := range config.GetMounts() {
+		if !filepath.IsAbs(mount.GetContainerPath()) {
+			errs.add(fmt.Sprintf("mounts[%d].container_path", i), "%q is not an absolute path", mount.GetContainerPath())
+		}
+		if !filepath.IsAbs(mount.GetHostPath()) {
+			errs.add(fmt.Sprintf("mounts[%d].host_path", i), "%q is not an absolute path", mount.GetHostPath())
+		}
+	}
+	if config.GetPrivileged() {
+		errs.add("privileged", "not supported by hypervisor-based sandboxes")
+	}
+	validateMetadata(&errs, config.GetLabels(), config.GetAnnotations())
+
+	return errs.toError("container")
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"bufio"
+	"os"
+	"strings"
+
+	"github.com/golang/glog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+const cpuInfoPath = "/proc/cpuinfo"
+
+// runningInVM returns whether the host itself is a VM, by the "hypervisor"
+// CPU flag.
+func runningInVM() bool {
+	f, err := os.Open(cpuInfoPath)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "flags") {
+			continue
+		}
+		for _, flag := range strings.Fields(line) {
+			if flag == "hypervisor" {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// kvmError returns the reason KVM isn't available, or nil if it is.
+func kvmError() error {
+	if kvmAvailable() {
+		return nil
+	}
+
+	if runningInVM() {
+		return grpc.Errorf(codes.FailedPrecondition,
+			"KVM is not available: this node is a VM, enable nested virtualization on its host")
+	}
+	return grpc.Errorf(codes.FailedPrecondition,
+		"KVM is not available: %s is missing, enable hardware virtualization and load the kvm modules", kvmDevice)
+}
+
+// checkVirtualization detects whether KVM is available at startup. Without
+// KVM, the kvm capability is reported as degraded in the runtime version.
+func (h *Runtime) checkVirtualization() {
+	err := kvmError()
+	if err == nil {
+		return
+	}
+
+	h.capabilities.disable(capabilityKVM, err)
+	if h.config.AllowEmulation {
+		glog.Warningf("Sandboxes will run with software emulation, which is much slower: %v", err)
+	} else {
+		glog.Errorf("Sandboxes can't be created: %v", err)
+	}
+}
+
+// virtualizationError returns why sandboxes can't be created, or nil if
+// they can. Sandboxes are created by emulation without KVM if allowed.
+func (h *Runtime) virtualizationError() error {
+	err := kvmError()
+	if err == nil {
+		return nil
+	}
+
+	if h.config.AllowEmulation {
+		glog.Warningf("Creating sandbox with software emulation: %v", err)
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,45 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// limitedCodec is the protobuf codec of gRPC rejecting received messages
+// larger than maxRecvMsgSize. The vendored grpc doesn't limit message sizes
+// itself.
+type limitedCodec struct {
+	maxRecvMsgSize int
+}
+
+func (c limitedCodec) Marshal(v interface{}) ([]byte, error) {
+	return proto.Marshal(v.(proto.Message))
+}
+
+func (c limitedCodec) Unmarshal(data []byte, v interface{}) error {
+	if len(data) > c.maxRecvMsgSize {
+		return grpc.Errorf(codes.ResourceExhausted, "received message larger than max (%d vs. %d)", len(data), c.maxRecvMsgSize)
+	}
+	return proto.Unmarshal(data, v.(proto.Message))
+}
+
+func (c limitedCodec) String() string {
+	return "proto"
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"time"
+)
+
+// Config contains the configurations of frakti manager.
+type Config struct {
+	// MaxSessionsPerContainer is the max number of concurrent exec sessions
+	// of a container, 0 means unlimited.
+	MaxSessionsPerContainer int
+	// SessionIdleTimeout is the timeout after which idle exec sessions are
+	// closed, 0 means never.
+	SessionIdleTimeout time.Duration
+	// ImagePrefetchDir is the drop-point directory of files listing images
+	// to prefetch, empty means disabled.
+	ImagePrefetchDir string
+	// ImagePrefetchInterval is the interval of scanning ImagePrefetchDir.
+	ImagePrefetchInterval time.Duration
+	// UpgradeSocket is the unix socket through which the listener is handed
+	// off between frakti processes on upgrade, empty means disabled. It's
+	// ignored unless the ListenerHandoff feature gate is enabled.
+	UpgradeSocket string
+	// MaxConcurrentStreams is the max number of concurrent streams of each
+	// gRPC connection, 0 means the gRPC default.
+	MaxConcurrentStreams uint32
+	// MaxRecvMsgSize is the max size in bytes of received gRPC messages, 0
+	// means unlimited.
+	//
+	// TODO: expose the max size of sent messages and keepalive enforcement
+	// once grpc is updated. The vendored grpc treats failing to encode
+	// responses as fatal, and doesn't support keepalive options.
+	MaxRecvMsgSize int
+}
+
+// NewDefaultConfig creates a Config with default values.
+func NewDefaultConfig() *Config {
+	return &Config{
+		MaxSessionsPerContainer: defaultMaxSessionsPerContainer,
+		SessionIdleTimeout:      defaultSessionIdleTimeout,
+		ImagePrefetchInterval:   defaultImagePrefetchInterval,
+	}
+}
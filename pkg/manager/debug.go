@@ -0,0 +1,199 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/golang/glog"
+	"k8s.io/frakti/pkg/metrics"
+	"k8s.io/frakti/pkg/runtime"
+)
+
+// ServeDebug starts the debug HTTP endpoint at addr, which is a unix socket
+// path if starts with "/", otherwise a tcp address. Handlers modifying
+// sandboxes are unauthenticated, so they are only served on unix sockets,
+// whose access is limited by file permissions.
+func (s *FraktiManager) ServeDebug(addr string) error {
+	glog.V(1).Infof("Start frakti debug endpoint at %s", addr)
+
+	network := "tcp"
+	if strings.HasPrefix(addr, "/") {
+		network = "unix"
+		if err := syscall.Unlink(addr); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	lis, err := net.Listen(network, addr)
+	if err != nil {
+		return err
+	}
+	defer lis.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/sessions", s.sessionsHandler(network == "unix"))
+	mux.HandleFunc("/debug/streaming", s.handleStreaming)
+	mux.HandleFunc("/debug/images/layers", s.handleImageLayers)
+	if network == "unix" {
+		mux.HandleFunc("/debug/sandboxes/force-delete", s.handleForceDelete)
+		mux.HandleFunc("/debug/sandboxes/labels", s.handleSandboxLabels)
+	}
+	mux.Handle("/metrics", metrics.Handler())
+	// TODO: add a /debug/mirror endpoint to mirror sandbox traffic to a pcap
+	// file or remote collector. It needs the host-side tap device of sandboxes,
+	// which hyperd doesn't report yet.
+	// TODO: add an audited endpoint to reconfigure running sandbox VMs for
+	// break-glass operations, e.g. adding memory, disks or NICs. hyperd has no
+	// API to hotplug them into a running VM yet.
+	// TODO: add an authenticated endpoint attaching to the serial console of
+	// sandbox VMs, read-only or interactive, for debugging guest boots. The
+	// console is only consumed by runv inside hyperd and isn't exposed yet.
+	// TODO: add an endpoint exporting the writable layer of a container as a
+	// tarball and diffing it against its image, for forensics. hyperd has no
+	// export or diff API, and container rootfs are only mounted inside VMs.
+	// TODO: add an audited endpoint committing a container to a local image,
+	// behind a feature gate, for incident response. hyperd has no commit API.
+	return http.Serve(lis, mux)
+}
+
+// writeJSON writes obj as the JSON response.
+func writeJSON(w http.ResponseWriter, obj interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(obj); err != nil {
+		glog.Errorf("Encode debug response failed: %v", err)
+	}
+}
+
+// sessionsHandler returns the handler listing exec sessions on GET, and
+// killing the session specified by "id" query parameter on DELETE if
+// allowKill. Both are limited to the sessions of the "namespace" query
+// parameter if set.
+func (s *FraktiManager) sessionsHandler(allowKill bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		namespace := r.URL.Query().Get("namespace")
+		switch {
+		case r.Method == "GET":
+			writeJSON(w, s.sessions.list(namespace))
+		case r.Method == "DELETE" && allowKill:
+			if err := s.sessions.kill(r.URL.Query().Get("id"), namespace); err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+			}
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// sandboxForceDeleter is implemented by runtimes supporting deletion of
+// sandboxes protected from deletion.
+type sandboxForceDeleter interface {
+	ForceDeletePodSandbox(podSandboxID string) error
+}
+
+// handleForceDelete deletes the sandbox specified by "id" query parameter on
+// POST, even if it is protected from deletion.
+func (s *FraktiManager) handleForceDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	deleter, ok := s.runtimeService.(sandboxForceDeleter)
+	if !ok {
+		http.Error(w, "force delete is not supported by the runtime", http.StatusNotImplemented)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "missing sandbox id", http.StatusBadRequest)
+		return
+	}
+
+	glog.Warningf("Force deleting sandbox %q via debug endpoint", id)
+	if err := deleter.ForceDeletePodSandbox(id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// sandboxLabelUpdater is implemented by runtimes supporting updating labels
+// of existing sandboxes.
+type sandboxLabelUpdater interface {
+	UpdatePodSandboxLabels(podSandboxID string, labels map[string]string, override bool) error
+}
+
+// handleSandboxLabels updates the labels of the sandbox specified by "id"
+// query parameter on POST, with a JSON object of labels as the body. The
+// labels are merged unless "override" query parameter is "true".
+func (s *FraktiManager) handleSandboxLabels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	updater, ok := s.runtimeService.(sandboxLabelUpdater)
+	if !ok {
+		http.Error(w, "updating labels is not supported by the runtime", http.StatusNotImplemented)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "missing sandbox id", http.StatusBadRequest)
+		return
+	}
+
+	var labels map[string]string
+	if err := json.NewDecoder(r.Body).Decode(&labels); err != nil {
+		http.Error(w, fmt.Sprintf("invalid labels: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	override := r.URL.Query().Get("override") == "true"
+	glog.V(3).Infof("Updating labels of sandbox %q via debug endpoint (override %v): %v", id, override, labels)
+	if err := updater.UpdatePodSandboxLabels(id, labels, override); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleImageLayers lists the layers of the image store on GET.
+func (s *FraktiManager) handleImageLayers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	lister, ok := s.imageService.(runtime.ImageLayerLister)
+	if !ok {
+		http.Error(w, "listing image layers is not supported by the runtime", http.StatusNotImplemented)
+		return
+	}
+
+	layers, err := lister.ListImageLayers()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, layers)
+}
@@ -0,0 +1,44 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"k8s.io/frakti/pkg/runtime"
+)
+
+// dryRunTrailer is the response trailer reporting what a dry run creation
+// would have created. Dry runs succeed with an empty ID.
+const dryRunTrailer = "frakti-dry-run"
+
+// reportDryRun returns whether err is the result of a dry run, and reports
+// it in the response trailer if so.
+func reportDryRun(ctx context.Context, err error) bool {
+	result, ok := err.(*runtime.DryRunResult)
+	if !ok {
+		return false
+	}
+
+	glog.V(3).Infof("Dry run: %s", result.Report)
+	if err := grpc.SetTrailer(ctx, metadata.Pairs(dryRunTrailer, result.Report)); err != nil {
+		glog.Warningf("Set dry run trailer failed: %v", err)
+	}
+	return true
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"io"
+	"sync"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+// execStreamWriter writes stdout or stderr of exec to the gRPC stream.
+type execStreamWriter struct {
+	sync.Mutex
+	stream  kubeapi.RuntimeService_ExecServer
+	session *execSession
+}
+
+func (w *execStreamWriter) send(resp *kubeapi.ExecResponse) error {
+	w.Lock()
+	defer w.Unlock()
+
+	w.session.touch()
+	return w.stream.Send(resp)
+}
+
+type stdoutWriter struct{ *execStreamWriter }
+
+func (w stdoutWriter) Write(p []byte) (int, error) {
+	if err := w.send(&kubeapi.ExecResponse{Stdout: p}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w stdoutWriter) Close() error { return nil }
+
+type stderrWriter struct{ *execStreamWriter }
+
+func (w stderrWriter) Write(p []byte) (int, error) {
+	if err := w.send(&kubeapi.ExecResponse{Stderr: p}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w stderrWriter) Close() error { return nil }
+
+// Exec execute a command in the container.
+//
+// TODO: propagate terminal resize events. Neither ExecRequest of kubelet
+// runtime API v1alpha1 nor hyperd's gRPC API carries the window size yet, so
+// TTY sessions keep the size set by the guest until both APIs support it.
+//
+// TODO: attach to running containers, closing the container's stdin on the
+// client's EOF with stdinOnce. Kubelet runtime API v1alpha1 has no Attach
+// RPC to serve it.
+func (s *FraktiManager) Exec(stream kubeapi.RuntimeService_ExecServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	glog.V(3).Infof("Exec with request %s", req.String())
+
+	containerID := req.GetContainerId()
+	session, err := s.sessions.add(containerID, s.containerNamespace(containerID), req.Cmd)
+	if err != nil {
+		glog.Errorf("Add exec session for container %q failed: %v", containerID, err)
+		return err
+	}
+	defer s.sessions.remove(session.id)
+
+	stdinReader, stdinWriter := io.Pipe()
+	go func() {
+		if len(req.Stdin) > 0 {
+			stdinWriter.Write(req.Stdin)
+		}
+		for {
+			r, err := stream.Recv()
+			if err != nil {
+				stdinWriter.Close()
+				return
+			}
+			session.touch()
+			if _, err := stdinWriter.Write(r.Stdin); err != nil {
+				return
+			}
+		}
+	}()
+
+	// Closing the session cancels the exec stream of the runtime as well.
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+
+	writer := &execStreamWriter{stream: stream, session: session}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.runtimeService.Exec(ctx, containerID, req.Cmd, req.GetTty(), stdinReader, stdoutWriter{writer}, stderrWriter{writer})
+	}()
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			glog.Errorf("Exec from runtime service failed: %v", err)
+		}
+		return err
+	case <-session.closed:
+		cancel()
+		stdinReader.Close()
+		return grpc.Errorf(codes.Aborted, "exec session %q closed: %s", session.id, session.closeReason)
+	}
+}
+
+// containerNamespacer is implemented by runtimes which could tell the
+// kubernetes namespace of containers.
+type containerNamespacer interface {
+	ContainerNamespace(containerID string) (string, error)
+}
+
+// containerNamespace returns the kubernetes namespace of the container, or
+// empty if it's unknown.
+func (s *FraktiManager) containerNamespace(containerID string) string {
+	namespacer, ok := s.runtimeService.(containerNamespacer)
+	if !ok {
+		return ""
+	}
+
+	namespace, err := namespacer.ContainerNamespace(containerID)
+	if err != nil {
+		glog.V(4).Infof("Get namespace of container %q failed: %v", containerID, err)
+		return ""
+	}
+	return namespace
+}
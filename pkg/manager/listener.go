@@ -0,0 +1,89 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// listenFdsStart is the first file descriptor passed by systemd socket
+	// activation.
+	listenFdsStart = 3
+)
+
+// inheritedListener returns the listener passed by systemd socket activation,
+// or nil if there isn't one. See sd_listen_fds(3).
+func inheritedListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	fds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || fds < 1 {
+		return nil, nil
+	}
+	if fds > 1 {
+		return nil, fmt.Errorf("expect one socket passed by systemd, got %d", fds)
+	}
+
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	syscall.CloseOnExec(listenFdsStart)
+
+	f := os.NewFile(uintptr(listenFdsStart), "LISTEN_FD")
+	defer f.Close()
+	return net.FileListener(f)
+}
+
+// listen returns the listener of frakti's unix socket. The socket of a
+// running frakti process is taken over if upgradeSocket is set, otherwise the
+// socket passed by systemd socket activation is used if there is one, so that
+// connections of kubelet are queued instead of dropped while frakti is
+// restarting.
+func listen(addr, upgradeSocket string) (net.Listener, error) {
+	if upgradeSocket != "" {
+		lis, err := handoffListener(upgradeSocket)
+		if err != nil {
+			return nil, err
+		}
+		if lis != nil {
+			glog.V(1).Infof("Took over socket %s from running frakti", lis.Addr())
+			return lis, nil
+		}
+	}
+
+	lis, err := inheritedListener()
+	if err != nil {
+		return nil, err
+	}
+	if lis != nil {
+		glog.V(1).Infof("Use socket %s passed by systemd", lis.Addr())
+		return lis, nil
+	}
+
+	if err := syscall.Unlink(addr); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return net.Listen("unix", addr)
+}
@@ -18,13 +18,13 @@ package manager
 
 import (
 	"fmt"
-	"net"
-	"os"
-	"syscall"
+	"sync"
+	"time"
 
 	"github.com/golang/glog"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"k8s.io/frakti/pkg/features"
 	"k8s.io/frakti/pkg/runtime"
 	kubeapi "k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
 )
@@ -41,17 +41,60 @@ type FraktiManager struct {
 
 	runtimeService runtime.RuntimeService
 	imageService   runtime.ImageService
+
+	// sessions tracks the exec sessions.
+	sessions *sessionManager
+
+	// streamingAddress is the advertised address of the streaming server,
+	// guarded by streamingLock as it's set once the server listens.
+	streamingLock    sync.RWMutex
+	streamingAddress string
+
+	// upgradeSocket is the socket handing off the listener to new frakti
+	// processes, and handedOff is closed once it's done.
+	upgradeSocket string
+	handedOff     chan struct{}
 }
 
 // NewFraktiManager creates a new FraktiManager
-func NewFraktiManager(runtimeService runtime.RuntimeService, imageService runtime.ImageService) (*FraktiManager, error) {
+func NewFraktiManager(runtimeService runtime.RuntimeService, imageService runtime.ImageService, config *Config) (*FraktiManager, error) {
+	if config.ImagePrefetchDir != "" && config.ImagePrefetchInterval <= 0 {
+		return nil, fmt.Errorf("image prefetch interval %v must be positive", config.ImagePrefetchInterval)
+	}
+
+	if config.MaxRecvMsgSize < 0 {
+		return nil, fmt.Errorf("max received message size %d must not be negative", config.MaxRecvMsgSize)
+	}
+
+	var opts []grpc.ServerOption
+	if config.MaxConcurrentStreams > 0 {
+		opts = append(opts, grpc.MaxConcurrentStreams(config.MaxConcurrentStreams))
+	}
+	if config.MaxRecvMsgSize > 0 {
+		opts = append(opts, grpc.CustomCodec(limitedCodec{maxRecvMsgSize: config.MaxRecvMsgSize}))
+	}
+	// Gzip compressed requests are accepted, which is safe as they are marked
+	// by grpc-encoding.
+	//
+	// TODO: compress responses for clients accepting gzip. The vendored grpc
+	// compresses every response once a compressor is set, without negotiating
+	// with clients, which kubelet doesn't support.
+	opts = append(opts, grpc.RPCDecompressor(grpc.NewGZIPDecompressor()))
+
 	s := &FraktiManager{
-		server:         grpc.NewServer(),
+		server:         grpc.NewServer(opts...),
 		runtimeService: runtimeService,
 		imageService:   imageService,
+		sessions:       newSessionManager(config.MaxSessionsPerContainer, config.SessionIdleTimeout),
+		upgradeSocket:  config.UpgradeSocket,
+		handedOff:      make(chan struct{}),
 	}
 	s.registerServer()
 
+	if config.ImagePrefetchDir != "" {
+		go newImagePrefetcher(config.ImagePrefetchDir, config.ImagePrefetchInterval, imageService).run()
+	}
+
 	return s, nil
 }
 
@@ -59,18 +102,32 @@ func NewFraktiManager(runtimeService runtime.RuntimeService, imageService runtim
 func (s *FraktiManager) Serve(addr string) error {
 	glog.V(1).Infof("Start frakti at %s", addr)
 
-	if err := syscall.Unlink(addr); err != nil && !os.IsNotExist(err) {
-		return err
+	if !features.Enabled(features.ListenerHandoff) {
+		s.upgradeSocket = ""
 	}
 
-	lis, err := net.Listen("unix", addr)
+	lis, err := listen(addr, s.upgradeSocket)
 	if err != nil {
 		glog.Fatalf("Failed to listen %s: %v", addr, err)
 		return err
 	}
 
+	if s.upgradeSocket != "" {
+		go s.serveUpgrade(s.upgradeSocket, lis)
+	}
+
 	defer lis.Close()
-	return s.server.Serve(lis)
+	err = s.server.Serve(lis)
+	select {
+	case <-s.handedOff:
+		// Established connections are still served, wait for in-flight
+		// calls before exiting.
+		glog.V(1).Infof("Draining in-flight calls for %v", upgradeDrainTimeout)
+		time.Sleep(upgradeDrainTimeout)
+		return nil
+	default:
+		return err
+	}
 }
 
 func (s *FraktiManager) registerServer() {
@@ -98,8 +155,15 @@ func (s *FraktiManager) Version(ctx context.Context, req *kubeapi.VersionRequest
 // CreatePodSandbox creates a hyper Pod
 func (s *FraktiManager) CreatePodSandbox(ctx context.Context, req *kubeapi.CreatePodSandboxRequest) (*kubeapi.CreatePodSandboxResponse, error) {
 	glog.V(3).Infof("CreatePodSandbox with request %s", req.String())
+	if err := normalizeRequest(req); err != nil {
+		glog.Errorf("CreatePodSandbox with invalid request: %v", err)
+		return nil, err
+	}
 
 	podID, err := s.runtimeService.CreatePodSandbox(req.Config)
+	if reportDryRun(ctx, err) {
+		return &kubeapi.CreatePodSandboxResponse{PodSandboxId: &podID}, nil
+	}
 	if err != nil {
 		glog.Errorf("CreatePodSandbox from runtime service failed: %v", err)
 		return nil, err
@@ -111,6 +175,10 @@ func (s *FraktiManager) CreatePodSandbox(ctx context.Context, req *kubeapi.Creat
 // StopPodSandbox stops the sandbox.
 func (s *FraktiManager) StopPodSandbox(ctx context.Context, req *kubeapi.StopPodSandboxRequest) (*kubeapi.StopPodSandboxResponse, error) {
 	glog.V(3).Infof("StopPodSandbox with request %s", req.String())
+	if err := normalizeRequest(req); err != nil {
+		glog.Errorf("StopPodSandbox with invalid request: %v", err)
+		return nil, err
+	}
 
 	err := s.runtimeService.StopPodSandbox(req.GetPodSandboxId())
 	if err != nil {
@@ -124,6 +192,10 @@ func (s *FraktiManager) StopPodSandbox(ctx context.Context, req *kubeapi.StopPod
 // DeletePodSandbox deletes the sandbox.
 func (s *FraktiManager) DeletePodSandbox(ctx context.Context, req *kubeapi.DeletePodSandboxRequest) (*kubeapi.DeletePodSandboxResponse, error) {
 	glog.V(3).Infof("DeletePodSandbox with request %s", req.String())
+	if err := normalizeRequest(req); err != nil {
+		glog.Errorf("DeletePodSandbox with invalid request: %v", err)
+		return nil, err
+	}
 
 	err := s.runtimeService.DeletePodSandbox(req.GetPodSandboxId())
 	if err != nil {
@@ -137,6 +209,10 @@ func (s *FraktiManager) DeletePodSandbox(ctx context.Context, req *kubeapi.Delet
 // PodSandboxStatus returns the Status of the PodSandbox.
 func (s *FraktiManager) PodSandboxStatus(ctx context.Context, req *kubeapi.PodSandboxStatusRequest) (*kubeapi.PodSandboxStatusResponse, error) {
 	glog.V(3).Infof("PodSandboxStatus with request %s", req.String())
+	if err := normalizeRequest(req); err != nil {
+		glog.Errorf("PodSandboxStatus with invalid request: %v", err)
+		return nil, err
+	}
 
 	podStatus, err := s.runtimeService.PodSandboxStatus(req.GetPodSandboxId())
 	if err != nil {
@@ -163,8 +239,15 @@ func (s *FraktiManager) ListPodSandbox(ctx context.Context, req *kubeapi.ListPod
 // CreateContainer creates a new container in specified PodSandbox
 func (s *FraktiManager) CreateContainer(ctx context.Context, req *kubeapi.CreateContainerRequest) (*kubeapi.CreateContainerResponse, error) {
 	glog.V(3).Infof("CreateContainer with request %s", req.String())
+	if err := normalizeRequest(req); err != nil {
+		glog.Errorf("CreateContainer with invalid request: %v", err)
+		return nil, err
+	}
 
 	containerID, err := s.runtimeService.CreateContainer(req.GetPodSandboxId(), req.Config, req.SandboxConfig)
+	if reportDryRun(ctx, err) {
+		return &kubeapi.CreateContainerResponse{ContainerId: &containerID}, nil
+	}
 	if err != nil {
 		glog.Errorf("CreateContainer from runtime service failed: %v", err)
 		return nil, err
@@ -176,6 +259,10 @@ func (s *FraktiManager) CreateContainer(ctx context.Context, req *kubeapi.Create
 // StartContainer starts the container.
 func (s *FraktiManager) StartContainer(ctx context.Context, req *kubeapi.StartContainerRequest) (*kubeapi.StartContainerResponse, error) {
 	glog.V(3).Infof("StartContainer with request %s", req.String())
+	if err := normalizeRequest(req); err != nil {
+		glog.Errorf("StartContainer with invalid request: %v", err)
+		return nil, err
+	}
 
 	err := s.runtimeService.StartContainer(req.GetContainerId())
 	if err != nil {
@@ -189,7 +276,14 @@ func (s *FraktiManager) StartContainer(ctx context.Context, req *kubeapi.StartCo
 // StopContainer stops a running container with a grace period (i.e. timeout).
 func (s *FraktiManager) StopContainer(ctx context.Context, req *kubeapi.StopContainerRequest) (*kubeapi.StopContainerResponse, error) {
 	glog.V(3).Infof("StopContainer with request %s", req.String())
+	if err := normalizeRequest(req); err != nil {
+		glog.Errorf("StopContainer with invalid request: %v", err)
+		return nil, err
+	}
 
+	// Sessions are closed even if stopping fails, as kubelet is tearing the
+	// container down anyway.
+	s.sessions.closeContainerSessions(req.GetContainerId(), "container stopped")
 	err := s.runtimeService.StopContainer(req.GetContainerId(), req.GetTimeout())
 	if err != nil {
 		glog.Errorf("StopContainer from runtime service failed: %v", err)
@@ -202,7 +296,12 @@ func (s *FraktiManager) StopContainer(ctx context.Context, req *kubeapi.StopCont
 // RemoveContainer removes the container.
 func (s *FraktiManager) RemoveContainer(ctx context.Context, req *kubeapi.RemoveContainerRequest) (*kubeapi.RemoveContainerResponse, error) {
 	glog.V(3).Infof("RemoveContainer with request %s", req.String())
+	if err := normalizeRequest(req); err != nil {
+		glog.Errorf("RemoveContainer with invalid request: %v", err)
+		return nil, err
+	}
 
+	s.sessions.closeContainerSessions(req.GetContainerId(), "container removed")
 	err := s.runtimeService.RemoveContainer(req.GetContainerId())
 	if err != nil {
 		glog.Errorf("RemoveContainer from runtime service failed: %v", err)
@@ -230,6 +329,10 @@ func (s *FraktiManager) ListContainers(ctx context.Context, req *kubeapi.ListCon
 // ContainerStatus returns the container status.
 func (s *FraktiManager) ContainerStatus(ctx context.Context, req *kubeapi.ContainerStatusRequest) (*kubeapi.ContainerStatusResponse, error) {
 	glog.V(3).Infof("ContainerStatus with request %s", req.String())
+	if err := normalizeRequest(req); err != nil {
+		glog.Errorf("ContainerStatus with invalid request: %v", err)
+		return nil, err
+	}
 
 	kubeStatus, err := s.runtimeService.ContainerStatus(req.GetContainerId())
 	if err != nil {
@@ -242,12 +345,6 @@ func (s *FraktiManager) ContainerStatus(ctx context.Context, req *kubeapi.Contai
 	}, nil
 }
 
-// Exec execute a command in the container.
-func (s *FraktiManager) Exec(stream kubeapi.RuntimeService_ExecServer) error {
-	// TODO: implement exec in container
-	return fmt.Errorf("Not implemented")
-}
-
 // ListImages lists existing images.
 func (s *FraktiManager) ListImages(ctx context.Context, req *kubeapi.ListImagesRequest) (*kubeapi.ListImagesResponse, error) {
 	glog.V(3).Infof("ListImages with request %s", req.String())
@@ -266,6 +363,10 @@ func (s *FraktiManager) ListImages(ctx context.Context, req *kubeapi.ListImagesR
 // ImageStatus returns the status of the image.
 func (s *FraktiManager) ImageStatus(ctx context.Context, req *kubeapi.ImageStatusRequest) (*kubeapi.ImageStatusResponse, error) {
 	glog.V(3).Infof("ImageStatus with request %s", req.String())
+	if err := normalizeRequest(req); err != nil {
+		glog.Errorf("ImageStatus with invalid request: %v", err)
+		return nil, err
+	}
 
 	status, err := s.imageService.ImageStatus(req.Image)
 	if err != nil {
@@ -278,6 +379,10 @@ func (s *FraktiManager) ImageStatus(ctx context.Context, req *kubeapi.ImageStatu
 // PullImage pulls a image with authentication config.
 func (s *FraktiManager) PullImage(ctx context.Context, req *kubeapi.PullImageRequest) (*kubeapi.PullImageResponse, error) {
 	glog.V(3).Infof("PullImage with request %s", req.String())
+	if err := normalizeRequest(req); err != nil {
+		glog.Errorf("PullImage with invalid request: %v", err)
+		return nil, err
+	}
 
 	err := s.imageService.PullImage(req.Image, req.Auth)
 	if err != nil {
@@ -291,6 +396,10 @@ func (s *FraktiManager) PullImage(ctx context.Context, req *kubeapi.PullImageReq
 // RemoveImage removes the image.
 func (s *FraktiManager) RemoveImage(ctx context.Context, req *kubeapi.RemoveImageRequest) (*kubeapi.RemoveImageResponse, error) {
 	glog.V(3).Infof("RemoveImage with request %s", req.String())
+	if err := normalizeRequest(req); err != nil {
+		glog.Errorf("RemoveImage with invalid request: %v", err)
+		return nil, err
+	}
 
 	err := s.imageService.RemoveImage(req.Image)
 	if err != nil {
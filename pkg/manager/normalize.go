@@ -0,0 +1,99 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+// normalizeRequest checks the fields required by a request and defaults its
+// optional fields in place, so that requests from older kubelets omitting
+// fields fail with InvalidArgument instead of nil pointer panics in runtimes.
+func normalizeRequest(req interface{}) error {
+	switch r := req.(type) {
+	case *kubeapi.CreatePodSandboxRequest:
+		if r.Config == nil {
+			return missingField("config")
+		}
+		normalizeSandboxConfig(r.Config)
+	case *kubeapi.StopPodSandboxRequest:
+		return requireField("pod_sandbox_id", r.GetPodSandboxId())
+	case *kubeapi.DeletePodSandboxRequest:
+		return requireField("pod_sandbox_id", r.GetPodSandboxId())
+	case *kubeapi.PodSandboxStatusRequest:
+		return requireField("pod_sandbox_id", r.GetPodSandboxId())
+	case *kubeapi.CreateContainerRequest:
+		if err := requireField("pod_sandbox_id", r.GetPodSandboxId()); err != nil {
+			return err
+		}
+		if r.Config == nil {
+			return missingField("config")
+		}
+		if err := requireField("config.image", r.Config.GetImage().GetImage()); err != nil {
+			return err
+		}
+		if r.Config.Labels == nil {
+			r.Config.Labels = make(map[string]string)
+		}
+		if r.Config.Annotations == nil {
+			r.Config.Annotations = make(map[string]string)
+		}
+		if r.SandboxConfig == nil {
+			r.SandboxConfig = &kubeapi.PodSandboxConfig{}
+		}
+		normalizeSandboxConfig(r.SandboxConfig)
+	case *kubeapi.StartContainerRequest:
+		return requireField("container_id", r.GetContainerId())
+	case *kubeapi.StopContainerRequest:
+		return requireField("container_id", r.GetContainerId())
+	case *kubeapi.RemoveContainerRequest:
+		return requireField("container_id", r.GetContainerId())
+	case *kubeapi.ContainerStatusRequest:
+		return requireField("container_id", r.GetContainerId())
+	case *kubeapi.ImageStatusRequest:
+		return requireField("image", r.GetImage().GetImage())
+	case *kubeapi.PullImageRequest:
+		return requireField("image", r.GetImage().GetImage())
+	case *kubeapi.RemoveImageRequest:
+		return requireField("image", r.GetImage().GetImage())
+	}
+
+	return nil
+}
+
+// normalizeSandboxConfig defaults the optional maps of a sandbox config.
+func normalizeSandboxConfig(config *kubeapi.PodSandboxConfig) {
+	if config.Labels == nil {
+		config.Labels = make(map[string]string)
+	}
+	if config.Annotations == nil {
+		config.Annotations = make(map[string]string)
+	}
+}
+
+func missingField(field string) error {
+	return grpc.Errorf(codes.InvalidArgument, "%s is required", field)
+}
+
+func requireField(field, value string) error {
+	if value == "" {
+		return missingField(field)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/frakti/pkg/runtime"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+const (
+	defaultImagePrefetchInterval = 30 * time.Second
+	// tmpPrefetchSuffix is the suffix of prefetch files being written.
+	tmpPrefetchSuffix = ".tmp"
+)
+
+// imageExistenceChecker is implemented by image managers which could check
+// whether an image exists locally.
+type imageExistenceChecker interface {
+	ImageExists(image string) (bool, error)
+}
+
+// imagePrefetcher pulls the images listed in files under a drop-point
+// directory in background, so that images of planned rollouts are present
+// before their pods are scheduled. Each file lists one image per line, and
+// is removed once all of its images are present. Images are pulled one at a
+// time to keep the impact on running pods low.
+//
+// Files should be written under a temporary name and renamed into place
+// once complete, so that partially written files are never read. Dotfiles
+// and files with the tmpPrefetchSuffix are ignored.
+type imagePrefetcher struct {
+	dir          string
+	interval     time.Duration
+	imageService runtime.ImageService
+}
+
+func newImagePrefetcher(dir string, interval time.Duration, imageService runtime.ImageService) *imagePrefetcher {
+	return &imagePrefetcher{
+		dir:          dir,
+		interval:     interval,
+		imageService: imageService,
+	}
+}
+
+// run scans the drop-point directory periodically.
+func (p *imagePrefetcher) run() {
+	glog.V(1).Infof("Start image prefetcher watching %s", p.dir)
+	for range time.Tick(p.interval) {
+		files, err := filepath.Glob(filepath.Join(p.dir, "*"))
+		if err != nil {
+			glog.Errorf("List image prefetch files failed: %v", err)
+			continue
+		}
+
+		for _, file := range files {
+			if isTmpPrefetchFile(file) {
+				continue
+			}
+			if p.prefetchFile(file) {
+				if err := os.Remove(file); err != nil {
+					glog.Warningf("Remove image prefetch file %q failed: %v", file, err)
+				}
+			}
+		}
+	}
+}
+
+// isTmpPrefetchFile returns whether file is still being written.
+func isTmpPrefetchFile(file string) bool {
+	name := filepath.Base(file)
+	return strings.HasPrefix(name, ".") || strings.HasSuffix(name, tmpPrefetchSuffix)
+}
+
+// imageExists returns whether the image exists locally. Image managers
+// supporting neither ImageExists nor ImageStatus always report the image
+// missing.
+func (p *imagePrefetcher) imageExists(spec *kubeapi.ImageSpec) bool {
+	if checker, ok := p.imageService.(imageExistenceChecker); ok {
+		exists, err := checker.ImageExists(spec.GetImage())
+		if err != nil {
+			glog.V(4).Infof("Check image %q exists failed: %v", spec.GetImage(), err)
+		}
+		return err == nil && exists
+	}
+
+	status, err := p.imageService.ImageStatus(spec)
+	return err == nil && status != nil
+}
+
+// prefetchFile pulls the images listed in file, and returns true if all of
+// them are present.
+func (p *imagePrefetcher) prefetchFile(file string) bool {
+	f, err := os.Open(file)
+	if err != nil {
+		glog.Warningf("Open image prefetch file %q failed: %v", file, err)
+		return false
+	}
+	defer f.Close()
+
+	done := true
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		image := strings.TrimSpace(scanner.Text())
+		if image == "" || strings.HasPrefix(image, "#") {
+			continue
+		}
+
+		spec := &kubeapi.ImageSpec{Image: &image}
+		if p.imageExists(spec) {
+			continue
+		}
+
+		glog.V(3).Infof("Prefetching image %q", image)
+		if err := p.imageService.PullImage(spec, nil); err != nil {
+			glog.Warningf("Prefetch image %q failed: %v", image, err)
+			done = false
+		}
+	}
+
+	return done && scanner.Err() == nil
+}
@@ -0,0 +1,202 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	defaultMaxSessionsPerContainer = 10
+	defaultSessionIdleTimeout      = 4 * time.Hour
+)
+
+// execSession is an exec stream of a container.
+type execSession struct {
+	id          string
+	containerID string
+	namespace   string
+	cmd         []string
+	createdAt   time.Time
+	// lastActive is the unix nano timestamp of the last stream activity.
+	lastActive int64
+
+	closeOnce   sync.Once
+	closeReason string
+	closed      chan struct{}
+}
+
+// touch records stream activity of the session.
+func (e *execSession) touch() {
+	atomic.StoreInt64(&e.lastActive, time.Now().UnixNano())
+}
+
+// close closes the session with the given reason.
+func (e *execSession) close(reason string) {
+	e.closeOnce.Do(func() {
+		e.closeReason = reason
+		close(e.closed)
+	})
+}
+
+// sessionInfo is the information of a session reported by the debug endpoint.
+type sessionInfo struct {
+	ID          string    `json:"id"`
+	ContainerID string    `json:"containerID"`
+	Namespace   string    `json:"namespace,omitempty"`
+	Cmd         []string  `json:"cmd"`
+	CreatedAt   time.Time `json:"createdAt"`
+	LastActive  time.Time `json:"lastActive"`
+}
+
+// sessionManager tracks exec sessions, enforcing the max concurrent sessions
+// per container and closing idle sessions.
+type sessionManager struct {
+	sync.Mutex
+	sessions    map[string]*execSession
+	nextID      uint64
+	maxSessions int
+	idleTimeout time.Duration
+}
+
+func newSessionManager(maxSessions int, idleTimeout time.Duration) *sessionManager {
+	m := &sessionManager{
+		sessions:    make(map[string]*execSession),
+		maxSessions: maxSessions,
+		idleTimeout: idleTimeout,
+	}
+	if idleTimeout > 0 {
+		go m.reapIdleSessions()
+	}
+
+	return m
+}
+
+// add creates a new session for the container.
+func (m *sessionManager) add(containerID, namespace string, cmd []string) (*execSession, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.maxSessions > 0 {
+		count := 0
+		for _, s := range m.sessions {
+			if s.containerID == containerID {
+				count++
+			}
+		}
+		if count >= m.maxSessions {
+			return nil, grpc.Errorf(codes.ResourceExhausted,
+				"container %q already has %d exec sessions", containerID, count)
+		}
+	}
+
+	m.nextID++
+	now := time.Now()
+	session := &execSession{
+		id:          fmt.Sprintf("%d", m.nextID),
+		containerID: containerID,
+		namespace:   namespace,
+		cmd:         cmd,
+		createdAt:   now,
+		lastActive:  now.UnixNano(),
+		closed:      make(chan struct{}),
+	}
+	m.sessions[session.id] = session
+
+	return session, nil
+}
+
+// remove removes the session from manager.
+func (m *sessionManager) remove(id string) {
+	m.Lock()
+	defer m.Unlock()
+
+	delete(m.sessions, id)
+}
+
+// kill closes the session by id, which must be in namespace unless it's
+// empty.
+func (m *sessionManager) kill(id, namespace string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	session, ok := m.sessions[id]
+	if !ok || (namespace != "" && session.namespace != namespace) {
+		return fmt.Errorf("exec session %q not found", id)
+	}
+
+	session.close("killed")
+	return nil
+}
+
+// closeContainerSessions closes all sessions of the container, e.g. when the
+// container exits.
+func (m *sessionManager) closeContainerSessions(containerID, reason string) {
+	m.Lock()
+	defer m.Unlock()
+
+	for _, session := range m.sessions {
+		if session.containerID == containerID {
+			session.close(reason)
+		}
+	}
+}
+
+// list lists the sessions in namespace, or all sessions if it's empty.
+func (m *sessionManager) list(namespace string) []sessionInfo {
+	m.Lock()
+	defer m.Unlock()
+
+	infos := make([]sessionInfo, 0, len(m.sessions))
+	for _, session := range m.sessions {
+		if namespace != "" && session.namespace != namespace {
+			continue
+		}
+		infos = append(infos, sessionInfo{
+			ID:          session.id,
+			ContainerID: session.containerID,
+			Namespace:   session.namespace,
+			Cmd:         session.cmd,
+			CreatedAt:   session.createdAt,
+			LastActive:  time.Unix(0, atomic.LoadInt64(&session.lastActive)),
+		})
+	}
+
+	return infos
+}
+
+// reapIdleSessions closes the sessions which are idle for longer than idleTimeout.
+func (m *sessionManager) reapIdleSessions() {
+	for range time.Tick(m.idleTimeout / 2) {
+		m.Lock()
+		for _, session := range m.sessions {
+			lastActive := time.Unix(0, atomic.LoadInt64(&session.lastActive))
+			if time.Since(lastActive) > m.idleTimeout {
+				glog.V(3).Infof("Closing idle exec session %q of container %q", session.id, session.containerID)
+				session.close("idle timeout")
+			}
+		}
+		m.Unlock()
+	}
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+// StreamingConfig contains the configurations of the streaming server, which
+// serves exec streams over TCP for clients not on the local node.
+type StreamingConfig struct {
+	// BindAddress is the IP address the streaming server binds to.
+	BindAddress string
+	// AdvertiseAddress is the IP address advertised to clients, defaults to
+	// BindAddress. It is required on multi-homed nodes binding 0.0.0.0.
+	AdvertiseAddress string
+	// PortRange is the range of ports, e.g. "10010-10020", the streaming
+	// server tries to listen on in order.
+	PortRange string
+	// TLSCertFile and TLSKeyFile are the certificate and key of the server,
+	// and TLSClientCAFile is the CA verifying client certificates. All of
+	// them are required, as streams execute commands in containers.
+	TLSCertFile     string
+	TLSKeyFile      string
+	TLSClientCAFile string
+}
+
+// streamingTLSConfig builds the mutual TLS config of the streaming server.
+func streamingTLSConfig(config *StreamingConfig) (*tls.Config, error) {
+	if config.TLSCertFile == "" || config.TLSKeyFile == "" || config.TLSClientCAFile == "" {
+		return nil, fmt.Errorf("streaming server requires TLS certificate, key and client CA files")
+	}
+
+	cert, err := tls.LoadX509KeyPair(config.TLSCertFile, config.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := ioutil.ReadFile(config.TLSClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificate found in client CA file %s", config.TLSClientCAFile)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	}, nil
+}
+
+// streamingServiceDesc describes the subset of RuntimeService served by the
+// streaming server, i.e. only Exec, so that remote clients can't call other
+// runtime RPCs.
+var streamingServiceDesc = grpc.ServiceDesc{
+	ServiceName: "runtime.RuntimeService",
+	HandlerType: (*kubeapi.RuntimeServiceServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Exec",
+			Handler:       streamingExecHandler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+}
+
+func streamingExecHandler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(kubeapi.RuntimeServiceServer).Exec(&execServer{stream})
+}
+
+// execServer implements kubeapi.RuntimeService_ExecServer on a stream.
+type execServer struct {
+	grpc.ServerStream
+}
+
+func (x *execServer) Send(m *kubeapi.ExecResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *execServer) Recv() (*kubeapi.ExecRequest, error) {
+	m := new(kubeapi.ExecRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// parsePortRange parses port range in format "start-end" or "port".
+func parsePortRange(portRange string) (int, int, error) {
+	parts := strings.SplitN(portRange, "-", 2)
+	start, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port range %q", portRange)
+	}
+	end := start
+	if len(parts) == 2 {
+		if end, err = strconv.Atoi(parts[1]); err != nil {
+			return 0, 0, fmt.Errorf("invalid port range %q", portRange)
+		}
+	}
+	if start <= 0 || end > 65535 || start > end {
+		return 0, 0, fmt.Errorf("invalid port range %q", portRange)
+	}
+
+	return start, end, nil
+}
+
+// listenInPortRange listens on the first available port in port range.
+func listenInPortRange(address, portRange string) (net.Listener, int, error) {
+	start, end, err := parsePortRange(portRange)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for port := start; port <= end; port++ {
+		lis, err := net.Listen("tcp", net.JoinHostPort(address, strconv.Itoa(port)))
+		if err == nil {
+			return lis, port, nil
+		}
+		glog.V(4).Infof("Listen on port %d failed: %v", port, err)
+	}
+
+	return nil, 0, fmt.Errorf("no available port in range %q", portRange)
+}
+
+// ServeStreaming starts the streaming server serving exec streams to clients
+// authenticated by certificates.
+func (s *FraktiManager) ServeStreaming(config *StreamingConfig) error {
+	tlsConfig, err := streamingTLSConfig(config)
+	if err != nil {
+		return err
+	}
+
+	lis, port, err := listenInPortRange(config.BindAddress, config.PortRange)
+	if err != nil {
+		return err
+	}
+	defer lis.Close()
+
+	advertiseAddress := config.AdvertiseAddress
+	if advertiseAddress == "" {
+		advertiseAddress = config.BindAddress
+	}
+	address := net.JoinHostPort(advertiseAddress, strconv.Itoa(port))
+	s.streamingLock.Lock()
+	s.streamingAddress = address
+	s.streamingLock.Unlock()
+	glog.V(1).Infof("Start frakti streaming server at %s, advertised as %s", lis.Addr(), address)
+
+	server := grpc.NewServer(grpc.Creds(credentials.NewTLS(tlsConfig)))
+	server.RegisterService(&streamingServiceDesc, s)
+	return server.Serve(lis)
+}
+
+// handleStreaming reports the advertised address of the streaming server.
+func (s *FraktiManager) handleStreaming(w http.ResponseWriter, r *http.Request) {
+	s.streamingLock.RLock()
+	address := s.streamingAddress
+	s.streamingLock.RUnlock()
+
+	writeJSON(w, map[string]interface{}{
+		"address": address,
+	})
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// upgradeDrainTimeout is the time in-flight calls are served after the
+	// listener is handed off to a new frakti process.
+	upgradeDrainTimeout = 30 * time.Second
+	// upgradeHandoffTimeout is the time to wait for the running frakti
+	// process to hand off its listener.
+	upgradeHandoffTimeout = 10 * time.Second
+)
+
+// handoffListener takes over the listener of a running frakti process through
+// its upgrade socket, or returns nil if there isn't a running one.
+func handoffListener(upgradeSocket string) (net.Listener, error) {
+	conn, err := net.Dial("unix", upgradeSocket)
+	if err != nil {
+		return nil, nil
+	}
+	defer conn.Close()
+
+	if err := conn.SetReadDeadline(time.Now().Add(upgradeHandoffTimeout)); err != nil {
+		return nil, err
+	}
+	oob := make([]byte, syscall.CmsgSpace(4))
+	_, oobn, _, _, err := conn.(*net.UnixConn).ReadMsgUnix(nil, oob)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(msgs) != 1 {
+		return nil, fmt.Errorf("invalid upgrade message: %v", err)
+	}
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	if err != nil || len(fds) != 1 {
+		return nil, fmt.Errorf("invalid upgrade rights: %v", err)
+	}
+
+	f := os.NewFile(uintptr(fds[0]), "frakti-listener")
+	defer f.Close()
+	return net.FileListener(f)
+}
+
+// serveUpgrade hands off lis to the first new frakti process connecting to
+// the upgrade socket, and then closes lis so that this process stops
+// accepting connections.
+//
+// TODO: hand off in-memory state (e.g. exec sessions and sandbox monitors)
+// as well. Sessions established before the upgrade are served by the old
+// process until drained.
+func (s *FraktiManager) serveUpgrade(upgradeSocket string, lis net.Listener) {
+	if err := syscall.Unlink(upgradeSocket); err != nil && !os.IsNotExist(err) {
+		glog.Errorf("Remove upgrade socket %s failed: %v", upgradeSocket, err)
+		return
+	}
+	upgradeLis, err := net.ListenUnix("unix", &net.UnixAddr{Name: upgradeSocket, Net: "unix"})
+	if err != nil {
+		glog.Errorf("Listen upgrade socket %s failed: %v", upgradeSocket, err)
+		return
+	}
+	defer upgradeLis.Close()
+
+	for {
+		conn, err := upgradeLis.Accept()
+		if err != nil {
+			glog.Errorf("Accept upgrade connection failed: %v", err)
+			return
+		}
+
+		if err := sendListener(conn.(*net.UnixConn), lis); err != nil {
+			glog.Errorf("Hand off listener failed: %v", err)
+			conn.Close()
+			continue
+		}
+		conn.Close()
+
+		glog.V(1).Infof("Listener handed off to new frakti process")
+		close(s.handedOff)
+		// The socket files are now served by the new process, which
+		// re-creates the upgrade socket for the next upgrade.
+		upgradeLis.SetUnlinkOnClose(false)
+		lis.(*net.UnixListener).SetUnlinkOnClose(false)
+		lis.Close()
+		return
+	}
+}
+
+func sendListener(conn *net.UnixConn, lis net.Listener) error {
+	unixLis, ok := lis.(*net.UnixListener)
+	if !ok {
+		return fmt.Errorf("listener %s isn't a unix listener", lis.Addr())
+	}
+	f, err := unixLis.File()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, _, err = conn.WriteMsgUnix(nil, syscall.UnixRights(int(f.Fd())), nil)
+	return err
+}
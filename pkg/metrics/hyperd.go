@@ -0,0 +1,39 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"time"
+)
+
+var (
+	// HyperdOperationsLatency is the latency of hyperd gRPC operations.
+	HyperdOperationsLatency = NewHistogramVec("frakti_hyperd_operations_latency_seconds",
+		"Latency in seconds of hyperd operations.", DefaultBuckets, "operation")
+	// HyperdOperationsErrors is the number of failed hyperd gRPC operations.
+	HyperdOperationsErrors = NewCounterVec("frakti_hyperd_operations_errors_total",
+		"Cumulative number of hyperd operation errors.", "operation")
+)
+
+// RecordHyperdOperation records the latency and the error of a hyperd operation.
+// It is intended to be deferred with a pointer to the named error result.
+func RecordHyperdOperation(operation string, start time.Time, err *error) {
+	HyperdOperationsLatency.ObserveSince(start, operation)
+	if err != nil && *err != nil {
+		HyperdOperationsErrors.Inc(operation)
+	}
+}
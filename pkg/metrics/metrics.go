@@ -0,0 +1,270 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// collector is a metric which could be written in prometheus text format.
+type collector interface {
+	write(w io.Writer)
+}
+
+var (
+	registryLock sync.Mutex
+	registry     []collector
+)
+
+func register(c collector) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	registry = append(registry, c)
+}
+
+// DefaultBuckets are the default histogram buckets in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120}
+
+// labelsString formats label names and values as {name="value",...}.
+func labelsString(names, values []string, extra ...string) string {
+	pairs := make([]string, 0, len(names)+1)
+	for i, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", name, values[i]))
+	}
+	pairs = append(pairs, extra...)
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// CounterVec is a set of counters partitioned by label values.
+type CounterVec struct {
+	sync.Mutex
+	name   string
+	help   string
+	labels []string
+	values map[string]float64
+}
+
+// NewCounterVec creates and registers a CounterVec.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{name: name, help: help, labels: labels, values: make(map[string]float64)}
+	register(c)
+	return c
+}
+
+// Add adds delta to the counter of the label values.
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.values[labelsString(c.labels, labelValues)] += delta
+}
+
+// Inc increases the counter of the label values by 1.
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.Lock()
+	defer c.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, labels := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %v\n", c.name, labels, c.values[labels])
+	}
+}
+
+// GaugeVec is a set of gauges partitioned by label values.
+type GaugeVec struct {
+	CounterVec
+	// kind is the metric type exported, "gauge" or "counter".
+	kind string
+}
+
+// NewGaugeVec creates and registers a GaugeVec.
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{CounterVec{name: name, help: help, labels: labels, values: make(map[string]float64)}, "gauge"}
+	register(g)
+	return g
+}
+
+// NewCumulativeVec creates and registers a GaugeVec exported as counters,
+// for cumulative values collected from elsewhere, e.g. CPU time reported by
+// hyperd, which are set rather than increased.
+func NewCumulativeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{CounterVec{name: name, help: help, labels: labels, values: make(map[string]float64)}, "counter"}
+	register(g)
+	return g
+}
+
+// Set sets the gauge of the label values.
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	g.Lock()
+	defer g.Unlock()
+
+	g.values[labelsString(g.labels, labelValues)] = value
+}
+
+// GaugeValues are the values of a GaugeVec, built up before replacing all
+// its values at once.
+type GaugeValues struct {
+	labels []string
+	values map[string]float64
+}
+
+// NewValues creates empty values of the GaugeVec.
+func (g *GaugeVec) NewValues() *GaugeValues {
+	return &GaugeValues{labels: g.labels, values: make(map[string]float64)}
+}
+
+// Set sets the value of the label values.
+func (v *GaugeValues) Set(value float64, labelValues ...string) {
+	v.values[labelsString(v.labels, labelValues)] = value
+}
+
+// Replace replaces all the gauges with values, so that scrapes see either
+// the old or the new values but never none of them.
+func (g *GaugeVec) Replace(values *GaugeValues) {
+	g.Lock()
+	defer g.Unlock()
+
+	g.values = values.values
+}
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.Lock()
+	defer g.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", g.name, g.help, g.name, g.kind)
+	for _, labels := range sortedKeys(g.values) {
+		fmt.Fprintf(w, "%s%s %v\n", g.name, labels, g.values[labels])
+	}
+}
+
+type histogram struct {
+	labelValues []string
+	counts      []uint64
+	sum         float64
+	count       uint64
+}
+
+// HistogramVec is a set of histograms partitioned by label values.
+type HistogramVec struct {
+	sync.Mutex
+	name       string
+	help       string
+	labels     []string
+	buckets    []float64
+	histograms map[string]*histogram
+}
+
+// NewHistogramVec creates and registers a HistogramVec.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{
+		name:       name,
+		help:       help,
+		labels:     labels,
+		buckets:    buckets,
+		histograms: make(map[string]*histogram),
+	}
+	register(h)
+	return h
+}
+
+// Observe adds an observation to the histogram of the label values.
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.Lock()
+	defer h.Unlock()
+
+	key := strings.Join(labelValues, "\x00")
+	hist, ok := h.histograms[key]
+	if !ok {
+		hist = &histogram{labelValues: labelValues, counts: make([]uint64, len(h.buckets))}
+		h.histograms[key] = hist
+	}
+
+	for i, bound := range h.buckets {
+		if value <= bound {
+			hist.counts[i]++
+		}
+	}
+	hist.sum += value
+	hist.count++
+}
+
+// ObserveSince observes the seconds elapsed since start.
+func (h *HistogramVec) ObserveSince(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.Lock()
+	defer h.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	keys := make([]string, 0, len(h.histograms))
+	for key := range h.histograms {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		hist := h.histograms[key]
+		for i, bound := range h.buckets {
+			le := fmt.Sprintf("le=\"%v\"", bound)
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelsString(h.labels, hist.labelValues, le), hist.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelsString(h.labels, hist.labelValues, "le=\"+Inf\""), hist.count)
+		fmt.Fprintf(w, "%s_sum%s %v\n", h.name, labelsString(h.labels, hist.labelValues), hist.sum)
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labelsString(h.labels, hist.labelValues), hist.count)
+	}
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Handler returns the http handler serving all metrics.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+		registryLock.Lock()
+		collectors := append([]collector(nil), registry...)
+		registryLock.Unlock()
+
+		for _, c := range collectors {
+			c.write(w)
+		}
+	})
+}
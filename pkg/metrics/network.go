@@ -0,0 +1,27 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+var (
+	// NetworkTeardownErrors is the number of failed sandbox network teardowns.
+	NetworkTeardownErrors = NewCounterVec("frakti_network_teardown_errors_total",
+		"Cumulative number of sandbox network teardown errors.")
+	// LeakedSandboxNetworks is the number of sandbox networks whose teardown
+	// failed and is still pending for retry.
+	LeakedSandboxNetworks = NewGaugeVec("frakti_leaked_sandbox_networks",
+		"Number of sandbox networks pending teardown retry.")
+)
@@ -0,0 +1,85 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+var (
+	// SandboxCrashes is the number of sandboxes whose VMs exited unexpectedly.
+	SandboxCrashes = NewCounterVec("frakti_sandbox_crashes_total",
+		"Cumulative number of sandbox VMs exited unexpectedly.", "namespace")
+	// SandboxCPUUsage is the cumulative CPU time consumed by sandbox VMs.
+	SandboxCPUUsage = NewCumulativeVec("frakti_sandbox_cpu_usage_seconds_total",
+		"Cumulative CPU time in seconds consumed by the sandbox.", "sandbox", "namespace", "pod", "mode")
+	// SandboxNetworkBytes is the bytes transferred by sandbox interfaces.
+	SandboxNetworkBytes = NewCumulativeVec("frakti_sandbox_network_bytes_total",
+		"Cumulative bytes transferred by the sandbox interface.", "sandbox", "namespace", "pod", "interface", "direction")
+	// SandboxNetworkPackets is the packets transferred by sandbox interfaces.
+	SandboxNetworkPackets = NewCumulativeVec("frakti_sandbox_network_packets_total",
+		"Cumulative packets transferred by the sandbox interface.", "sandbox", "namespace", "pod", "interface", "direction")
+	// SandboxNetworkErrors is the errors of sandbox interfaces.
+	SandboxNetworkErrors = NewCumulativeVec("frakti_sandbox_network_errors_total",
+		"Cumulative errors of the sandbox interface.", "sandbox", "namespace", "pod", "interface", "direction")
+	// SandboxNetworkDropped is the packets dropped by sandbox interfaces.
+	SandboxNetworkDropped = NewCumulativeVec("frakti_sandbox_network_dropped_total",
+		"Cumulative packets dropped by the sandbox interface.", "sandbox", "namespace", "pod", "interface", "direction")
+	// SandboxCPUPeriods and SandboxCPUThrottledPeriods are the enforcement
+	// periods of the CPU quota of sandbox VMs on the host, and the periods
+	// the VMs were throttled in.
+	SandboxCPUPeriods = NewCumulativeVec("frakti_sandbox_cpu_periods_total",
+		"Cumulative number of CPU quota enforcement periods of the sandbox VM.", "sandbox", "namespace", "pod")
+	SandboxCPUThrottledPeriods = NewCumulativeVec("frakti_sandbox_cpu_throttled_periods_total",
+		"Cumulative number of CPU quota enforcement periods the sandbox VM was throttled in.", "sandbox", "namespace", "pod")
+	// SandboxCPUThrottledTime is the time sandbox VMs were throttled on the
+	// host.
+	SandboxCPUThrottledTime = NewCumulativeVec("frakti_sandbox_cpu_throttled_seconds_total",
+		"Cumulative time in seconds the sandbox VM was throttled.", "sandbox", "namespace", "pod")
+	// ContainerCPUUsage is the cumulative CPU time consumed by containers
+	// inside sandbox VMs.
+	ContainerCPUUsage = NewCumulativeVec("frakti_container_cpu_usage_seconds_total",
+		"Cumulative CPU time in seconds consumed by the container.", "sandbox", "namespace", "container", "mode")
+	// ContainerMemoryUsage is the memory usage of containers inside sandbox
+	// VMs, partitioned by type such as "usage" and "working_set".
+	ContainerMemoryUsage = NewGaugeVec("frakti_container_memory_bytes",
+		"Memory in bytes used by the container.", "sandbox", "namespace", "container", "type")
+	// ContainerMemoryFailures is the number of times containers hit their
+	// memory limits.
+	ContainerMemoryFailures = NewCumulativeVec("frakti_container_memory_failures_total",
+		"Cumulative number of memory limit hits of the container.", "sandbox", "namespace", "container")
+	// ContainerPageFaults is the number of page faults of containers.
+	ContainerPageFaults = NewCumulativeVec("frakti_container_page_faults_total",
+		"Cumulative number of page faults of the container.", "sandbox", "namespace", "container", "type")
+	// ContainerFsUsage is the usage of container filesystems, partitioned by
+	// type "usage", "limit" and "available", for disk pressure evaluation.
+	ContainerFsUsage = NewGaugeVec("frakti_container_fs_bytes",
+		"Filesystem bytes of the container.", "sandbox", "namespace", "container", "device", "type")
+	// ContainerBlkioBytes is the bytes transferred by block IO of containers.
+	ContainerBlkioBytes = NewCumulativeVec("frakti_container_blkio_bytes_total",
+		"Cumulative bytes transferred by block IO of the container.", "sandbox", "namespace", "container", "op")
+	// ContainerBlkioOperations is the number of block IO operations of containers.
+	ContainerBlkioOperations = NewCumulativeVec("frakti_container_blkio_operations_total",
+		"Cumulative number of block IO operations of the container.", "sandbox", "namespace", "container", "op")
+	// RemovalQueueDepth is the number of sandboxes pending removal in
+	// background.
+	RemovalQueueDepth = NewGaugeVec("frakti_removal_queue_depth",
+		"Number of sandboxes pending removal in background.")
+	// SandboxCreationLatency is the latency of each phase of sandbox creations.
+	SandboxCreationLatency = NewHistogramVec("frakti_sandbox_creation_latency_seconds",
+		"Latency in seconds of each phase of sandbox creations.", DefaultBuckets, "phase")
+	// ContainerCreationLatency is the latency of each phase of container
+	// creations.
+	ContainerCreationLatency = NewHistogramVec("frakti_container_creation_latency_seconds",
+		"Latency in seconds of each phase of container creations.", DefaultBuckets, "phase")
+)
@@ -0,0 +1,145 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// Faults configures the faults injected into the methods of fake services.
+type Faults struct {
+	// Default is the faults of methods not in Methods.
+	Default MethodFaults `json:"default"`
+	// Methods maps method names, e.g. "CreatePodSandbox", to their faults.
+	Methods map[string]*MethodFaults `json:"methods"`
+}
+
+// MethodFaults are the faults injected into a method.
+type MethodFaults struct {
+	// Latency is added to each call, e.g. "100ms", with up to Jitter more
+	// at random.
+	Latency string `json:"latency"`
+	Jitter  string `json:"jitter"`
+	// ErrorRate is the fraction of calls failing without taking effect.
+	ErrorRate float64 `json:"errorRate"`
+	// PartialFailureRate is the fraction of calls failing after taking
+	// effect, e.g. a sandbox is created but its creation reported failed.
+	PartialFailureRate float64 `json:"partialFailureRate"`
+
+	latency time.Duration
+	jitter  time.Duration
+}
+
+// complete validates the faults and parses their durations.
+func (f *MethodFaults) complete() error {
+	var err error
+	if f.Latency != "" {
+		if f.latency, err = time.ParseDuration(f.Latency); err != nil || f.latency < 0 {
+			return fmt.Errorf("invalid latency %q", f.Latency)
+		}
+	}
+	if f.Jitter != "" {
+		if f.jitter, err = time.ParseDuration(f.Jitter); err != nil || f.jitter < 0 {
+			return fmt.Errorf("invalid jitter %q", f.Jitter)
+		}
+	}
+	if f.ErrorRate < 0 || f.PartialFailureRate < 0 || f.ErrorRate+f.PartialFailureRate > 1 {
+		return fmt.Errorf("errorRate %v and partialFailureRate %v must not be negative nor sum over 1",
+			f.ErrorRate, f.PartialFailureRate)
+	}
+	return nil
+}
+
+// LoadFaults loads faults from a JSON file.
+func LoadFaults(path string) (*Faults, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	faults := &Faults{}
+	if err := json.Unmarshal(data, faults); err != nil {
+		return nil, fmt.Errorf("parse faults %s failed: %v", path, err)
+	}
+	return faults, nil
+}
+
+// faultInjector injects the configured faults into calls.
+type faultInjector struct {
+	faults *Faults
+
+	// rand isn't safe for concurrent use.
+	randLock sync.Mutex
+	rand     *rand.Rand
+}
+
+// newFaultInjector creates a faultInjector, no faults are injected if faults
+// is nil.
+func newFaultInjector(faults *Faults) (*faultInjector, error) {
+	if faults == nil {
+		faults = &Faults{}
+	}
+	if err := faults.Default.complete(); err != nil {
+		return nil, fmt.Errorf("default: %v", err)
+	}
+	for method, f := range faults.Methods {
+		if err := f.complete(); err != nil {
+			return nil, fmt.Errorf("%s: %v", method, err)
+		}
+	}
+
+	return &faultInjector{
+		faults: faults,
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}, nil
+}
+
+func (i *faultInjector) float64() float64 {
+	i.randLock.Lock()
+	defer i.randLock.Unlock()
+	return i.rand.Float64()
+}
+
+// inject delays a call of method by its latency. It returns the error the
+// call should fail with before taking effect, and the error it should fail
+// with after taking effect, at most one of which is non-nil.
+func (i *faultInjector) inject(method string) (before, after error) {
+	f, ok := i.faults.Methods[method]
+	if !ok {
+		f = &i.faults.Default
+	}
+
+	if delay := f.latency + time.Duration(i.float64()*float64(f.jitter)); delay > 0 {
+		time.Sleep(delay)
+	}
+
+	switch r := i.float64(); {
+	case r < f.ErrorRate:
+		return grpc.Errorf(codes.Unavailable, "injected failure of %s", method), nil
+	case r < f.ErrorRate+f.PartialFailureRate:
+		return nil, grpc.Errorf(codes.Unavailable, "injected partial failure of %s", method)
+	}
+	return nil, nil
+}
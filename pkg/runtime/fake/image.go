@@ -0,0 +1,118 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sync"
+
+	"k8s.io/frakti/pkg/runtime"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+// fakeImageSize is the size reported of all images.
+const fakeImageSize = 1024 * 1024
+
+// ImageService is an in-memory runtime.ImageService. Pulled images are only
+// recorded, nothing is downloaded.
+type ImageService struct {
+	sync.Mutex
+	faults *faultInjector
+	images map[string]*kubeapi.Image
+}
+
+var _ runtime.ImageService = &ImageService{}
+
+// NewImageService creates a fake ImageService with faults injected.
+func NewImageService(faults *Faults) (*ImageService, error) {
+	injector, err := newFaultInjector(faults)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ImageService{
+		faults: injector,
+		images: make(map[string]*kubeapi.Image),
+	}, nil
+}
+
+// ListImages lists the pulled images matching filter.
+func (s *ImageService) ListImages(filter *kubeapi.ImageFilter) ([]*kubeapi.Image, error) {
+	if before, after := s.faults.inject("ListImages"); before != nil || after != nil {
+		return nil, firstError(before, after)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	var images []*kubeapi.Image
+	for name, image := range s.images {
+		if filter.GetImage().GetImage() != "" && filter.GetImage().GetImage() != name {
+			continue
+		}
+		images = append(images, image)
+	}
+	return images, nil
+}
+
+// ImageStatus returns the status of the image, or nil if it isn't pulled.
+func (s *ImageService) ImageStatus(image *kubeapi.ImageSpec) (*kubeapi.Image, error) {
+	if before, after := s.faults.inject("ImageStatus"); before != nil || after != nil {
+		return nil, firstError(before, after)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	return s.images[image.GetImage()], nil
+}
+
+// PullImage records the image as pulled.
+func (s *ImageService) PullImage(image *kubeapi.ImageSpec, auth *kubeapi.AuthConfig) error {
+	before, after := s.faults.inject("PullImage")
+	if before != nil {
+		return before
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	name := image.GetImage()
+	id := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(name)))
+	size := uint64(fakeImageSize)
+	s.images[name] = &kubeapi.Image{
+		Id:       &id,
+		RepoTags: []string{name},
+		Size_:    &size,
+	}
+	return after
+}
+
+// RemoveImage removes the image.
+func (s *ImageService) RemoveImage(image *kubeapi.ImageSpec) error {
+	before, after := s.faults.inject("RemoveImage")
+	if before != nil {
+		return before
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.images, image.GetImage())
+	return after
+}
@@ -0,0 +1,409 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"k8s.io/frakti/pkg/runtime"
+	kubeapi "k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
+)
+
+const (
+	fakeRuntimeName    = "fake"
+	fakeRuntimeVersion = "0.1.0"
+	fakeAPIVersion     = "0.1.0"
+)
+
+type fakeContainer struct {
+	sandboxID string
+	status    *kubeapi.ContainerStatus
+}
+
+// RuntimeService is an in-memory runtime.RuntimeService. Sandboxes and
+// containers only change state, no VMs or processes are run.
+type RuntimeService struct {
+	sync.Mutex
+	faults     *faultInjector
+	nextID     int
+	sandboxes  map[string]*kubeapi.PodSandboxStatus
+	containers map[string]*fakeContainer
+}
+
+var _ runtime.RuntimeService = &RuntimeService{}
+
+// NewRuntimeService creates a fake RuntimeService with faults injected.
+func NewRuntimeService(faults *Faults) (*RuntimeService, error) {
+	injector, err := newFaultInjector(faults)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RuntimeService{
+		faults:     injector,
+		sandboxes:  make(map[string]*kubeapi.PodSandboxStatus),
+		containers: make(map[string]*fakeContainer),
+	}, nil
+}
+
+// newID returns a new unique ID, the caller should hold the lock.
+func (r *RuntimeService) newID(kind string) string {
+	r.nextID++
+	return fmt.Sprintf("%s-%d", kind, r.nextID)
+}
+
+// Version returns the runtime name, runtime version and runtime API version.
+func (r *RuntimeService) Version() (string, string, string, error) {
+	if before, after := r.faults.inject("Version"); before != nil || after != nil {
+		return "", "", "", firstError(before, after)
+	}
+	return fakeRuntimeName, fakeRuntimeVersion, fakeAPIVersion, nil
+}
+
+// CreatePodSandbox creates a ready sandbox.
+func (r *RuntimeService) CreatePodSandbox(config *kubeapi.PodSandboxConfig) (string, error) {
+	before, after := r.faults.inject("CreatePodSandbox")
+	if before != nil {
+		return "", before
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	id := r.newID("sandbox")
+	state := kubeapi.PodSandBoxState_READY
+	createdAt := time.Now().Unix()
+	r.sandboxes[id] = &kubeapi.PodSandboxStatus{
+		Id:          &id,
+		Name:        config.Name,
+		State:       &state,
+		CreatedAt:   &createdAt,
+		Labels:      config.Labels,
+		Annotations: config.Annotations,
+	}
+	if after != nil {
+		return "", after
+	}
+	return id, nil
+}
+
+// StopPodSandbox stops the sandbox and its containers.
+func (r *RuntimeService) StopPodSandbox(podSandboxID string) error {
+	before, after := r.faults.inject("StopPodSandbox")
+	if before != nil {
+		return before
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	sandbox, ok := r.sandboxes[podSandboxID]
+	if !ok {
+		return nil
+	}
+	state := kubeapi.PodSandBoxState_NOTREADY
+	sandbox.State = &state
+	for _, container := range r.containers {
+		if container.sandboxID == podSandboxID {
+			stopContainer(container)
+		}
+	}
+	return after
+}
+
+// DeletePodSandbox deletes the sandbox and its containers.
+func (r *RuntimeService) DeletePodSandbox(podSandboxID string) error {
+	before, after := r.faults.inject("DeletePodSandbox")
+	if before != nil {
+		return before
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	if _, ok := r.sandboxes[podSandboxID]; !ok {
+		return notFound("sandbox", podSandboxID)
+	}
+	delete(r.sandboxes, podSandboxID)
+	for id, container := range r.containers {
+		if container.sandboxID == podSandboxID {
+			delete(r.containers, id)
+		}
+	}
+	return after
+}
+
+// PodSandboxStatus returns the status of the sandbox.
+func (r *RuntimeService) PodSandboxStatus(podSandboxID string) (*kubeapi.PodSandboxStatus, error) {
+	if before, after := r.faults.inject("PodSandboxStatus"); before != nil || after != nil {
+		return nil, firstError(before, after)
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	sandbox, ok := r.sandboxes[podSandboxID]
+	if !ok {
+		return nil, notFound("sandbox", podSandboxID)
+	}
+	status := *sandbox
+	return &status, nil
+}
+
+// ListPodSandbox lists the sandboxes matching filter.
+func (r *RuntimeService) ListPodSandbox(filter *kubeapi.PodSandboxFilter) ([]*kubeapi.PodSandbox, error) {
+	if before, after := r.faults.inject("ListPodSandbox"); before != nil || after != nil {
+		return nil, firstError(before, after)
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	var sandboxes []*kubeapi.PodSandbox
+	for id, sandbox := range r.sandboxes {
+		if filter != nil {
+			if (filter.Id != nil && filter.GetId() != id) ||
+				(filter.Name != nil && filter.GetName() != sandbox.GetName()) ||
+				(filter.State != nil && filter.GetState() != sandbox.GetState()) ||
+				!matchLabels(sandbox.Labels, filter.LabelSelector) {
+				continue
+			}
+		}
+		sandboxes = append(sandboxes, &kubeapi.PodSandbox{
+			Id:        sandbox.Id,
+			Name:      sandbox.Name,
+			State:     sandbox.State,
+			CreatedAt: sandbox.CreatedAt,
+			Labels:    sandbox.Labels,
+		})
+	}
+	return sandboxes, nil
+}
+
+// CreateContainer creates a container in the sandbox.
+func (r *RuntimeService) CreateContainer(podSandboxID string, config *kubeapi.ContainerConfig, sandboxConfig *kubeapi.PodSandboxConfig) (string, error) {
+	before, after := r.faults.inject("CreateContainer")
+	if before != nil {
+		return "", before
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	sandbox, ok := r.sandboxes[podSandboxID]
+	if !ok {
+		return "", notFound("sandbox", podSandboxID)
+	}
+	if sandbox.GetState() != kubeapi.PodSandBoxState_READY {
+		return "", grpc.Errorf(codes.FailedPrecondition, "sandbox %q is not ready", podSandboxID)
+	}
+
+	id := r.newID("container")
+	state := kubeapi.ContainerState_CREATED
+	createdAt := time.Now().Unix()
+	r.containers[id] = &fakeContainer{
+		sandboxID: podSandboxID,
+		status: &kubeapi.ContainerStatus{
+			Id:          &id,
+			Name:        config.Name,
+			State:       &state,
+			CreatedAt:   &createdAt,
+			Image:       config.Image,
+			ImageRef:    config.GetImage().Image,
+			Labels:      config.Labels,
+			Annotations: config.Annotations,
+			Mounts:      config.Mounts,
+		},
+	}
+	if after != nil {
+		return "", after
+	}
+	return id, nil
+}
+
+// StartContainer starts the container.
+func (r *RuntimeService) StartContainer(rawContainerID string) error {
+	before, after := r.faults.inject("StartContainer")
+	if before != nil {
+		return before
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	container, ok := r.containers[rawContainerID]
+	if !ok {
+		return notFound("container", rawContainerID)
+	}
+	if container.status.GetState() != kubeapi.ContainerState_CREATED {
+		return grpc.Errorf(codes.FailedPrecondition, "container %q is not created", rawContainerID)
+	}
+	state := kubeapi.ContainerState_RUNNING
+	startedAt := time.Now().Unix()
+	container.status.State = &state
+	container.status.StartedAt = &startedAt
+	return after
+}
+
+// StopContainer stops the container, ignoring the timeout.
+func (r *RuntimeService) StopContainer(rawContainerID string, timeout int64) error {
+	before, after := r.faults.inject("StopContainer")
+	if before != nil {
+		return before
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	container, ok := r.containers[rawContainerID]
+	if !ok {
+		return notFound("container", rawContainerID)
+	}
+	stopContainer(container)
+	return after
+}
+
+// stopContainer marks a running container exited.
+func stopContainer(container *fakeContainer) {
+	if container.status.GetState() != kubeapi.ContainerState_RUNNING {
+		return
+	}
+	state := kubeapi.ContainerState_EXITED
+	finishedAt := time.Now().Unix()
+	exitCode := int32(0)
+	container.status.State = &state
+	container.status.FinishedAt = &finishedAt
+	container.status.ExitCode = &exitCode
+}
+
+// RemoveContainer removes the container.
+func (r *RuntimeService) RemoveContainer(rawContainerID string) error {
+	before, after := r.faults.inject("RemoveContainer")
+	if before != nil {
+		return before
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	delete(r.containers, rawContainerID)
+	return after
+}
+
+// ListContainers lists the containers matching filter.
+func (r *RuntimeService) ListContainers(filter *kubeapi.ContainerFilter) ([]*kubeapi.Container, error) {
+	if before, after := r.faults.inject("ListContainers"); before != nil || after != nil {
+		return nil, firstError(before, after)
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	var containers []*kubeapi.Container
+	for id, container := range r.containers {
+		status := container.status
+		if filter != nil {
+			if (filter.Id != nil && filter.GetId() != id) ||
+				(filter.Name != nil && filter.GetName() != status.GetName()) ||
+				(filter.State != nil && filter.GetState() != status.GetState()) ||
+				(filter.PodSandboxId != nil && filter.GetPodSandboxId() != container.sandboxID) ||
+				!matchLabels(status.Labels, filter.LabelSelector) {
+				continue
+			}
+		}
+		containers = append(containers, &kubeapi.Container{
+			Id:       status.Id,
+			Name:     status.Name,
+			Image:    status.Image,
+			ImageRef: status.ImageRef,
+			State:    status.State,
+			Labels:   status.Labels,
+		})
+	}
+	return containers, nil
+}
+
+// ContainerStatus returns the status of the container.
+func (r *RuntimeService) ContainerStatus(rawContainerID string) (*kubeapi.ContainerStatus, error) {
+	if before, after := r.faults.inject("ContainerStatus"); before != nil || after != nil {
+		return nil, firstError(before, after)
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	container, ok := r.containers[rawContainerID]
+	if !ok {
+		return nil, notFound("container", rawContainerID)
+	}
+	status := *container.status
+	return &status, nil
+}
+
+// Exec succeeds at once without output for running containers.
+func (r *RuntimeService) Exec(ctx context.Context, rawContainerID string, cmd []string, tty bool, stdin io.Reader, stdout, stderr io.WriteCloser) error {
+	before, after := r.faults.inject("Exec")
+	if before != nil {
+		return before
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	container, ok := r.containers[rawContainerID]
+	if !ok {
+		return notFound("container", rawContainerID)
+	}
+	if container.status.GetState() != kubeapi.ContainerState_RUNNING {
+		return grpc.Errorf(codes.FailedPrecondition, "container %q is not running", rawContainerID)
+	}
+	return after
+}
+
+// matchLabels returns whether labels has all labels of selector.
+func matchLabels(labels, selector map[string]string) bool {
+	for k, v := range selector {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func notFound(kind, id string) error {
+	return grpc.Errorf(codes.NotFound, "%s %q not found", kind, id)
+}
+
+// firstError returns the non-nil one of errs, for methods without effects
+// whose partial failures are plain failures.
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
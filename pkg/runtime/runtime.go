@@ -19,6 +19,7 @@ package runtime
 import (
 	"io"
 
+	"golang.org/x/net/context"
 	runtimeApi "k8s.io/kubernetes/pkg/kubelet/api/v1alpha1/runtime"
 )
 
@@ -55,8 +56,9 @@ type RuntimeService interface {
 	ListContainers(filter *runtimeApi.ContainerFilter) ([]*runtimeApi.Container, error)
 	// ContainerStatus returns the status of the container.
 	ContainerStatus(rawContainerID string) (*runtimeApi.ContainerStatus, error)
-	// Exec executes a command in the container.
-	Exec(rawContainerID string, cmd []string, tty bool, stdin io.Reader, stdout, stderr io.WriteCloser) error
+	// Exec executes a command in the container, until the command exits or
+	// ctx is canceled.
+	Exec(ctx context.Context, rawContainerID string, cmd []string, tty bool, stdin io.Reader, stdout, stderr io.WriteCloser) error
 }
 
 // ImageService interface should be implemented by a container image manager.
@@ -72,3 +74,34 @@ type ImageService interface {
 	// It should return success if the image has already been removed.
 	RemoveImage(image *runtimeApi.ImageSpec) error
 }
+
+// DryRunResult is returned by creations which are dry runs instead of
+// creating anything. It's not a failure, but reports what would have been
+// created.
+type DryRunResult struct {
+	Report string
+}
+
+func (r *DryRunResult) Error() string {
+	return "dry run: " + r.Report
+}
+
+// ImageLayer describes a layer of the image store.
+type ImageLayer struct {
+	ID       string `json:"id"`
+	ParentID string `json:"parentID,omitempty"`
+	// Size is the disk usage in bytes of the layer itself, excluding its
+	// parents.
+	Size int64 `json:"size"`
+	// Tags are the image tags referring to the layer.
+	Tags []string `json:"tags,omitempty"`
+	// SharedBy is the number of tagged images built on the layer.
+	SharedBy int `json:"sharedBy"`
+}
+
+// ImageLayerLister is implemented by image managers which could list the
+// layers of their image store.
+type ImageLayerLister interface {
+	// ListImageLayers lists all layers of the image store.
+	ListImageLayers() ([]*ImageLayer, error)
+}